@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// chunkAnomalyWindow 计算中位数使用的最近分块数, chunkAnomalyMinSamples 之前不判断, 短于 chunkAnomalyMinDuration 的分块不告警
+const (
+	chunkAnomalyWindow      = 50
+	chunkAnomalyMinSamples  = 5
+	chunkAnomalyMinDuration = time.Second
+)
+
+// chunkTimer 记录单表最近分块的耗时, 某个分块超过中位数的 -chunk-anomaly-factor 倍时告警,
+// 通常说明源库有锁等待或缺少索引, 需要在导出过程中处理.
+type chunkTimer struct {
+	mu        sync.Mutex
+	durations []time.Duration
+}
+
+// Observe 记录一个分块的耗时, 返回此前的中位数和是否异常
+func (t *chunkTimer) Observe(d time.Duration, factor float64) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var median time.Duration
+	anomalous := false
+	if len(t.durations) >= chunkAnomalyMinSamples {
+		sorted := append([]time.Duration{}, t.durations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		median = sorted[len(sorted)/2]
+		anomalous = d >= chunkAnomalyMinDuration && float64(d) > factor*float64(median)
+	}
+
+	t.durations = append(t.durations, d)
+	if len(t.durations) > chunkAnomalyWindow {
+		t.durations = t.durations[1:]
+	}
+
+	return median, anomalous
+}
+
+// reportChunkAnomaly 记录慢分块告警, 设置 -chunk-anomaly-webhook 时 POST 一条 json 通知
+func reportChunkAnomaly(workArgs workArgsT, chunk int64, d time.Duration, median time.Duration) {
+	workArgs.Logger.Printf("[reportChunkAnomaly] chunk %d took %s, %.1fx of median %s, check locks and indexes on source",
+		chunk, d, float64(d)/float64(median), median)
+	workArgs.Summary.Warn()
+
+	if len(workArgs.ChunkAnomalyWebhook) == 0 {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"table":     workArgs.Table,
+		"chunk":     chunk,
+		"seconds":   d.Seconds(),
+		"median":    median.Seconds(),
+		"database":  workArgs.Database,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(workArgs.ChunkAnomalyWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		workArgs.Logger.Printf("[reportChunkAnomaly] webhook err: %v", err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		workArgs.Logger.Printf("[reportChunkAnomaly] webhook status: %s", resp.Status)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+var (
+	targetCreateRe = regexp.MustCompile("(?is)CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?((?:[`\"]?[\\w$]+[`\"]?\\.)?[`\"]?[\\w$]+[`\"]?)\\s*\\((.*?)\\n\\)")
+	targetColumnRe = regexp.MustCompile("^\\s*(?:`([^`]+)`|\"([^\"]+)\"|([\\w$]+))\\s")
+)
+
+// 建表语句中不是列定义的行
+var targetNotColumn = map[string]bool{
+	"PRIMARY": true, "KEY": true, "UNIQUE": true, "INDEX": true, "CONSTRAINT": true,
+	"FOREIGN": true, "CHECK": true, "FULLTEXT": true, "SPATIAL": true, "EXCLUDE": true,
+}
+
+// loadTargetColumns 读取目标库(-target-dsn)或目标建表语句(-target-ddl)中表的列, 都未设置时返回 nil
+func loadTargetColumns(workArgs workArgsT, table string) ([]string, error) {
+	if len(workArgs.TargetDSN) > 0 {
+		driver := "mysql"
+		querySQL := "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION"
+		if workArgs.DbType == "postgres" {
+			driver = "postgres"
+			querySQL = "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position"
+		}
+
+		db, err := sql.Open(driver, workArgs.TargetDSN)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = db.Close()
+		}()
+
+		rows, err := db.Query(querySQL, table)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = rows.Close()
+		}()
+
+		var cols []string
+		for rows.Next() {
+			var col string
+			if err = rows.Scan(&col); err != nil {
+				return nil, err
+			}
+			cols = append(cols, col)
+		}
+
+		return cols, rows.Err()
+	}
+
+	if len(workArgs.TargetDDL) > 0 {
+		ddl, err := ioutil.ReadFile(workArgs.TargetDDL)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseTargetColumns(string(ddl), table), nil
+	}
+
+	return nil, nil
+}
+
+// parseTargetColumns 从建表语句中解析出指定表的列
+func parseTargetColumns(ddl string, table string) []string {
+	return parseCreateTables(ddl)[table]
+}
+
+// parseCreateTables 解析 SQL 中所有建表语句的列, 要求每个列定义单独一行(SHOW CREATE TABLE / pg_dump 的格式)
+func parseCreateTables(ddl string) map[string][]string {
+	tables := make(map[string][]string)
+
+	for _, m := range targetCreateRe.FindAllStringSubmatch(ddl, -1) {
+		name := strings.NewReplacer("`", "", `"`, "").Replace(m[1])
+		if idx := strings.LastIndex(name, "."); idx >= 0 {
+			name = name[idx+1:]
+		}
+
+		var cols []string
+		for _, line := range strings.Split(m[2], "\n") {
+			cm := targetColumnRe.FindStringSubmatch(line)
+			if cm == nil {
+				continue
+			}
+			col := cm[1] + cm[2] + cm[3]
+			if len(cm[3]) > 0 && targetNotColumn[strings.ToUpper(col)] {
+				continue
+			}
+			cols = append(cols, col)
+		}
+
+		tables[name] = cols
+	}
+
+	return tables
+}
+
+var jsonColumnRe = regexp.MustCompile("(?i)^\\s*(?:`([^`]+)`|\"([^\"]+)\"|([\\w$]+))\\s+jsonb?\\b")
+
+// parseJSONColumns 解析 SQL 中建表语句的 json/jsonb 列, 返回 表名 -> 列名集合
+func parseJSONColumns(ddl string) map[string]map[string]bool {
+	tables := make(map[string]map[string]bool)
+
+	for _, m := range targetCreateRe.FindAllStringSubmatch(ddl, -1) {
+		name := strings.NewReplacer("`", "", `"`, "").Replace(m[1])
+		if idx := strings.LastIndex(name, "."); idx >= 0 {
+			name = name[idx+1:]
+		}
+
+		cols := make(map[string]bool)
+		for _, line := range strings.Split(m[2], "\n") {
+			if cm := jsonColumnRe.FindStringSubmatch(line); cm != nil {
+				cols[cm[1]+cm[2]+cm[3]] = true
+			}
+		}
+		tables[name] = cols
+	}
+
+	return tables
+}
+
+// backfillValue 目标表新增列的取值, 优先使用 -backfill=table.col=value, 其次 -backfill=col=value, 未配置时使用 DEFAULT
+func backfillValue(workArgs workArgsT, col string) string {
+	value, ok := workArgs.Backfill[insertTable(workArgs)+"."+col]
+	if !ok {
+		value, ok = workArgs.Backfill[col]
+	}
+	if !ok {
+		return "DEFAULT"
+	}
+
+	return fmt.Sprintf(`'%s'`, workArgs.EscapeFunc(value))
+}
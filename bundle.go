@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// bundleColumn 数据仓库装载包中的一列
+type bundleColumn struct {
+	Name     string
+	DbType   string
+	Nullable bool
+}
+
+// doWorkExportBundle 为每张表在 -bundle-dir 下生成数据仓库可直接装载的数据文件, 表结构文件和装载脚本
+func doWorkExportBundle(workArgs workArgsT) {
+	log.Printf("[doWorkExportBundle] start work, bundle: %s, dir: %s", workArgs.Bundle, workArgs.BundleDir)
+
+	if err := os.MkdirAll(workArgs.BundleDir, 0755); err != nil {
+		log.Printf("[doWorkExportBundle] can not create bundle dir: %s, err: %v", workArgs.BundleDir, err)
+		os.Exit(20)
+	}
+
+	// 装载工具只认标准的时间格式
+	workArgs.DateFormat = mysqlDateLayout
+	workArgs.TimestampFormat = mysqlDatetimeLayout
+
+	var script, uploads []string
+	for _, tbl := range fetchTables(workArgs) {
+		taskArgs := withTaskLogger(workArgs, tbl, 0)
+		taskArgs.Table = tbl
+		if taskArgs.Limit > 0 || len(taskArgs.Sample) > 0 {
+			taskArgs.Sampler, _ = newRowSampler(taskArgs.Limit, taskArgs.Sample)
+		}
+		if workArgs.ColumnStats {
+			taskArgs.Stats = &tableStats{Table: tbl}
+		}
+
+		switch workArgs.Bundle {
+		case "bigquery":
+			script = append(script, exportBigQueryTable(taskArgs))
+		case "snowflake":
+			dataFile := exportCSVGzipTable(taskArgs)
+			absDir, _ := filepath.Abs(workArgs.BundleDir)
+			script = append(script,
+				fmt.Sprintf("PUT 'file://%s' @db_export_stage AUTO_COMPRESS = FALSE;", filepath.ToSlash(filepath.Join(absDir, dataFile))),
+				fmt.Sprintf("COPY INTO %s FROM @db_export_stage/%s FILE_FORMAT = (FORMAT_NAME = db_export_csv);\n", tbl, dataFile))
+		case "redshift":
+			dataFile := exportCSVGzipTable(taskArgs)
+			uploads = append(uploads, fmt.Sprintf("aws s3 cp %s \"$S3_PREFIX/%s\"", dataFile, dataFile))
+			script = append(script, fmt.Sprintf("COPY %s FROM '%s/%s' IAM_ROLE '<iam-role-arn>' CSV GZIP IGNOREHEADER 1 NULL AS '\\\\N' DATEFORMAT 'auto' TIMEFORMAT 'auto';",
+				tbl, workArgs.BundleS3Prefix, dataFile))
+		}
+
+		if taskArgs.Stats != nil {
+			writeBundleFile(workArgs, tbl+".stats.json", string(taskArgs.Stats.JSON()), 0644)
+		}
+	}
+
+	switch workArgs.Bundle {
+	case "bigquery":
+		writeBundleFile(workArgs, "load.sh", "#!/bin/sh\nset -e\n\n"+strings.Join(script, "\n")+"\n", 0755)
+	case "snowflake":
+		// 执行: snowsql -f load.sql
+		header := `CREATE OR REPLACE FILE FORMAT db_export_csv TYPE = CSV COMPRESSION = GZIP FIELD_OPTIONALLY_ENCLOSED_BY = '"' SKIP_HEADER = 1 NULL_IF = ('\\N') EMPTY_FIELD_AS_NULL = FALSE;
+CREATE TEMPORARY STAGE IF NOT EXISTS db_export_stage FILE_FORMAT = db_export_csv;
+
+`
+		writeBundleFile(workArgs, "load.sql", header+strings.Join(script, "\n")+"\n", 0644)
+	case "redshift":
+		// upload.sh 上传到 S3, 再在 Redshift 中执行 load.sql, 需要替换 IAM_ROLE 占位符
+		writeBundleFile(workArgs, "upload.sh", fmt.Sprintf("#!/bin/sh\nset -e\n\nS3_PREFIX=\"${S3_PREFIX:-%s}\"\n\n%s\n", workArgs.BundleS3Prefix, strings.Join(uploads, "\n")), 0755)
+		writeBundleFile(workArgs, "load.sql", strings.Join(script, "\n")+"\n", 0644)
+	}
+
+	log.Printf("[doWorkExportBundle] jobs have done.")
+}
+
+// exportBigQueryTable 写出 <table>.json (NDJSON) 和 <table>.schema.json, 返回对应的 bq load 命令
+func exportBigQueryTable(workArgs workArgsT) string {
+	dataFile := workArgs.Table + ".json"
+	schemaFile := workArgs.Table + ".schema.json"
+
+	f, err := os.Create(filepath.Join(workArgs.BundleDir, dataFile))
+	if err != nil {
+		workArgs.Logger.Printf("[exportBigQueryTable] can not create data file, err: %v", err)
+		os.Exit(20)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	w := bufio.NewWriter(f)
+
+	var columns []bundleColumn
+	var rowsNum int64
+	forEachDataRow(workArgs, func(cols []bundleColumn, vals []interface{}) {
+		columns = cols
+
+		var sb strings.Builder
+		sb.WriteByte('{')
+		for k, col := range cols {
+			if k > 0 {
+				sb.WriteByte(',')
+			}
+			key, _ := json.Marshal(col.Name)
+			sb.Write(key)
+			sb.WriteByte(':')
+			sb.WriteString(bigqueryValue(workArgs, vals[k], col.DbType))
+		}
+		sb.WriteString("}\n")
+
+		_, _ = w.WriteString(sb.String())
+		rowsNum++
+	})
+	if errF := w.Flush(); errF != nil {
+		workArgs.Logger.Printf("[exportBigQueryTable] write err: %v", errF)
+		os.Exit(20)
+	}
+
+	type bigqueryField struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Mode string `json:"mode"`
+	}
+	fields := make([]bigqueryField, len(columns))
+	for k, col := range columns {
+		mode := "REQUIRED"
+		if col.Nullable {
+			mode = "NULLABLE"
+		}
+		fields[k] = bigqueryField{Name: col.Name, Type: bigqueryType(col.DbType), Mode: mode}
+	}
+	schema, _ := json.MarshalIndent(fields, "", "  ")
+	writeBundleFile(workArgs, schemaFile, string(schema)+"\n", 0644)
+
+	workArgs.Logger.Printf("[exportBigQueryTable] rows: %d", rowsNum)
+
+	dataset := workArgs.BundleDataset
+	if len(dataset) == 0 {
+		dataset = workArgs.Database
+	}
+
+	return fmt.Sprintf("bq load --source_format=NEWLINE_DELIMITED_JSON --replace %s.%s %s %s", dataset, workArgs.Table, dataFile, schemaFile)
+}
+
+// exportCSVGzipTable 写出带表头的 <table>.csv.gz, NULL 写为 \N, 返回文件名
+func exportCSVGzipTable(workArgs workArgsT) string {
+	dataFile := workArgs.Table + ".csv.gz"
+
+	f, err := os.Create(filepath.Join(workArgs.BundleDir, dataFile))
+	if err != nil {
+		workArgs.Logger.Printf("[exportCSVGzipTable] can not create data file, err: %v", err)
+		os.Exit(20)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	zw := gzip.NewWriter(f)
+	w := csv.NewWriter(zw)
+
+	var rowsNum int64
+	forEachDataRow(workArgs, func(cols []bundleColumn, vals []interface{}) {
+		if rowsNum == 0 {
+			header := make([]string, len(cols))
+			for k, col := range cols {
+				header[k] = col.Name
+			}
+			_ = w.Write(header)
+		}
+
+		record := make([]string, len(cols))
+		for k, col := range cols {
+			if vals[k] == nil {
+				record[k] = `\N`
+				continue
+			}
+			record[k] = renderValue(workArgs, vals[k], col.DbType)
+		}
+		_ = w.Write(record)
+		rowsNum++
+	})
+
+	w.Flush()
+	errW := w.Error()
+	if errW == nil {
+		errW = zw.Close()
+	}
+	if errW != nil {
+		workArgs.Logger.Printf("[exportCSVGzipTable] write err: %v", errW)
+		os.Exit(20)
+	}
+
+	workArgs.Logger.Printf("[exportCSVGzipTable] rows: %d", rowsNum)
+
+	return dataFile
+}
+
+// forEachDataRow 查询单表全部数据, 按 -skip-field/-only-field 去掉列后逐行回调, 遵循 -where, -limit 和 -sample;
+// 开启 -column-stats 时同时统计各列.
+func forEachDataRow(workArgs workArgsT, fn func(columns []bundleColumn, vals []interface{})) {
+	querySQL := fmt.Sprintf("%s FROM %s%s", selectFields(workArgs), selectFrom(workArgs), dataWhere(workArgs))
+	workArgs.Logger.Printf("[forEachDataRow] sql: %s", querySQL)
+
+	rows, err := workArgs.DB.Query(querySQL)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	skipFields := strings.Split(workArgs.SkipField, ",")
+	var onlyFields []string
+	if len(workArgs.OnlyField) > 0 {
+		onlyFields = strings.Split(workArgs.OnlyField, ",")
+	}
+
+	names, _ := rows.Columns()
+	types, _ := rows.ColumnTypes()
+
+	var columns []bundleColumn
+	var fieldIdx []int
+	var fieldNames, fieldTypes []string
+	for k, name := range names {
+		if tools.InArray(name, skipFields) || (onlyFields != nil && !tools.InArray(name, onlyFields)) {
+			continue
+		}
+		nullable, ok := types[k].Nullable()
+		columns = append(columns, bundleColumn{Name: name, DbType: types[k].DatabaseTypeName(), Nullable: nullable || !ok})
+		fieldIdx = append(fieldIdx, k)
+		fieldNames = append(fieldNames, name)
+		fieldTypes = append(fieldTypes, types[k].DatabaseTypeName())
+	}
+	masked := workArgs.Masker.Columns(workArgs.Table, fieldNames)
+	workArgs.Summary.AddRows(workArgs.Table, 0)
+
+	for rows.Next() {
+		if workArgs.Sampler.Done() {
+			break
+		}
+
+		refs := make([]interface{}, len(names))
+		for i := range refs {
+			var ref interface{}
+			refs[i] = &ref
+		}
+		if errS := rows.Scan(refs...); errS != nil {
+			workArgs.Logger.Printf("[forEachDataRow] rows.Scan err: %v", errS)
+			continue
+		}
+		if !workArgs.Sampler.Keep() {
+			continue
+		}
+
+		vals := make([]interface{}, len(fieldIdx))
+		for i, k := range fieldIdx {
+			vals[i] = reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
+		}
+		workArgs.Throttle.Wait(1, rowSize(vals))
+		if len(masked) > 0 {
+			workArgs.Masker.Apply(workArgs, masked, fieldNames, fieldTypes, vals)
+		}
+		workArgs.Stats.Add(workArgs, columns, vals)
+		fn(columns, vals)
+
+		// 这些格式在最后才写出, 按读取的行和值的大小累计 -max-total-rows/-max-total-bytes
+		workArgs.Summary.AddRows(workArgs.Table, 1)
+		workArgs.Summary.AddBytes(int64(rowSize(vals)))
+		workArgs.Summary.CheckLimits(workArgs)
+	}
+	if errR := rows.Err(); errR != nil {
+		panic(errR)
+	}
+}
+
+// bigqueryType 把源库列类型映射为 BigQuery 标准 SQL 类型
+func bigqueryType(dbType string) string {
+	dbType = strings.ToUpper(dbType)
+
+	switch dbType {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "INT2", "INT4", "INT8":
+		return "INT64"
+	case "UNSIGNED BIGINT", "DECIMAL", "NUMERIC":
+		return "NUMERIC"
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8":
+		return "FLOAT64"
+	case "BOOL", "BOOLEAN":
+		return "BOOL"
+	case "DATE":
+		return "DATE"
+	case "DATETIME", "TIMESTAMP":
+		return "DATETIME"
+	case "TIMESTAMPTZ":
+		return "TIMESTAMP"
+	case "TIME":
+		return "TIME"
+	case "JSON", "JSONB":
+		return "JSON"
+	}
+	if binaryColumnTypes[dbType] {
+		return "BYTES"
+	}
+
+	return "STRING"
+}
+
+// bigqueryValue 按 BigQuery 类型输出 JSON 值, BYTES 使用 base64
+func bigqueryValue(workArgs workArgsT, val interface{}, dbType string) string {
+	if val == nil {
+		return "null"
+	}
+
+	text := renderValue(workArgs, val, dbType)
+	switch bigqueryType(dbType) {
+	case "INT64", "FLOAT64":
+		if isJSONNumber(text) {
+			return text
+		}
+	case "BOOL":
+		if text == "1" || strings.EqualFold(text, "true") {
+			return "true"
+		}
+		return "false"
+	case "BYTES":
+		if b, ok := val.([]byte); ok {
+			text = base64.StdEncoding.EncodeToString(b)
+		}
+	case "JSON":
+		// JSON 列作为嵌套对象装载, 不转成字符串
+		if json.Valid([]byte(text)) {
+			return text
+		}
+	}
+
+	value, _ := json.Marshal(text)
+	return string(value)
+}
+
+// writeBundleFile 在 -bundle-dir 下写出一个小文件
+func writeBundleFile(workArgs workArgsT, name string, content string, perm os.FileMode) {
+	if err := ioutil.WriteFile(filepath.Join(workArgs.BundleDir, name), []byte(content), perm); err != nil {
+		log.Printf("[writeBundleFile] write %s err: %v", name, err)
+		os.Exit(20)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// chaosT 故障注入, 按比例让数据查询失败, 变慢或写出失败, 用于演练 -max-duration 断点续传等流程; 参数不在帮助信息中显示
+type chaosT struct {
+	QueryErrorRate float64
+	SlowChunkRate  float64
+	SlowChunk      time.Duration
+	WriteErrorRate float64
+	Seed           int64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+var errChaosQuery = errors.New("chaos: injected query error")
+var errChaosWrite = errors.New("chaos: injected write error")
+
+// hit 按比例返回是否注入故障, 设置 -chaos-seed 时结果可重现
+func (c *chaosT) hit(rate float64) bool {
+	if c == nil || rate <= 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rnd == nil {
+		seed := c.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		c.rnd = rand.New(rand.NewSource(seed))
+	}
+
+	return c.rnd.Float64() < rate
+}
+
+// BeforeQuery 在数据查询之前调用, 可能先等待 -chaos-slow-chunk, 再返回注入的查询错误
+func (c *chaosT) BeforeQuery(workArgs workArgsT) error {
+	if c.hit(c.SlowChunkRate) {
+		workArgs.Logger.Printf("[chaos] slow chunk: %s", c.SlowChunk)
+		time.Sleep(c.SlowChunk)
+	}
+	if c.hit(c.QueryErrorRate) {
+		return errChaosQuery
+	}
+
+	return nil
+}
+
+// Write 写出一个分块, 按比例返回注入的写错误
+func (c *chaosT) Write(output io.Writer, p []byte) (int, error) {
+	if c.hit(c.WriteErrorRate) {
+		return 0, errChaosWrite
+	}
+
+	return output.Write(p)
+}
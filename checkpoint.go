@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// exitPartial 到达 -max-duration 后在分块边界停止, 可以用 checkpoint 继续导出
+const exitPartial = 75
+
+// checkpointT 数据导出的断点: 多表导出时已完成的表和正在导出的表的位置, Key 为空表示按 OFFSET 分页
+type checkpointT struct {
+	Done    []string `json:"done,omitempty"`
+	Table   string   `json:"table"`
+	Key     string   `json:"key"`      // 分页键, 多列以逗号分隔
+	LastKey []string `json:"last_key"` // 分页键各列已导出的最后一行的值
+	Chunk   int64    `json:"chunk"`
+}
+
+// readCheckpointFile 读取断点文件, 文件不存在时返回空断点
+func readCheckpointFile(filename string) (checkpointT, error) {
+	var cp checkpointT
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cp, nil
+		}
+		return cp, err
+	}
+
+	err = json.Unmarshal(data, &cp)
+	return cp, err
+}
+
+// writeCheckpointFile 保存断点, 已完成的表沿用文件中的记录
+func writeCheckpointFile(filename string, cp checkpointT) error {
+	saved, err := readCheckpointFile(filename)
+	if err != nil {
+		return err
+	}
+	cp.Done = saved.Done
+
+	data, _ := json.MarshalIndent(cp, "", "  ")
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// loadCheckpoint 读取断点文件, 文件不存在或不是当前表的断点时返回 nil
+func loadCheckpoint(workArgs workArgsT) (*checkpointT, error) {
+	if len(workArgs.CheckpointFile) == 0 {
+		return nil, nil
+	}
+
+	cp, err := readCheckpointFile(workArgs.CheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(cp.Table) == 0 || cp.Table != workArgs.Table {
+		return nil, nil
+	}
+
+	return &cp, nil
+}
+
+// checkpointDone 断点文件中记录该表已导出完成, 继续导出时跳过
+func checkpointDone(workArgs workArgsT, table string) bool {
+	if len(workArgs.CheckpointFile) == 0 {
+		return false
+	}
+
+	cp, err := readCheckpointFile(workArgs.CheckpointFile)
+	if err != nil {
+		workArgs.Logger.Printf("[checkpointDone] read checkpoint err: %v", err)
+		os.Exit(34)
+	}
+
+	return tools.InArray(table, cp.Done)
+}
+
+// markCheckpointDone 每张表导出完成后记入断点文件, 超时或分块失败后继续导出不会重复导出该表
+func markCheckpointDone(workArgs workArgsT) {
+	if len(workArgs.CheckpointFile) == 0 {
+		return
+	}
+
+	cp, err := readCheckpointFile(workArgs.CheckpointFile)
+	if err == nil {
+		data, _ := json.MarshalIndent(checkpointT{Done: append(cp.Done, workArgs.Table)}, "", "  ")
+		err = ioutil.WriteFile(workArgs.CheckpointFile, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		workArgs.Logger.Printf("[markCheckpointDone] write checkpoint err: %v", err)
+		os.Exit(34)
+	}
+}
+
+// stopAtDeadline 超过 -max-duration 时保存断点并以 exitPartial 退出, 只在分块边界调用
+func stopAtDeadline(workArgs workArgsT, output io.Writer, cp checkpointT) {
+	if workArgs.Deadline.IsZero() || time.Now().Before(workArgs.Deadline) {
+		return
+	}
+
+	if len(workArgs.CheckpointFile) > 0 {
+		if err := writeCheckpointFile(workArgs.CheckpointFile, cp); err != nil {
+			workArgs.Logger.Printf("[stopAtDeadline] write checkpoint err: %v", err)
+			os.Exit(34)
+		}
+	}
+
+	_, _ = io.WriteString(output, fmt.Sprintf("/* partial export: max duration reached before chunk %d, resumable */\n", cp.Chunk))
+	workArgs.Logger.Printf("[stopAtDeadline] max duration reached, stop before chunk %d, checkpoint: %s", cp.Chunk, workArgs.CheckpointFile)
+	os.Exit(exitPartial)
+}
+
+// stopOnChunkError 分块查询或写出失败时保存该分块之前的断点并退出, 继续导出时从失败的分块重新开始; cp 为 nil 表示不支持断点
+func stopOnChunkError(workArgs workArgsT, output io.Writer, cp *checkpointT, result chunkResult) {
+	if cp != nil && len(workArgs.CheckpointFile) > 0 {
+		if err := writeCheckpointFile(workArgs.CheckpointFile, *cp); err != nil {
+			workArgs.Logger.Printf("[stopOnChunkError] write checkpoint err: %v", err)
+			os.Exit(34)
+		}
+		_, _ = io.WriteString(output, fmt.Sprintf("/* partial export: chunk %d failed, resumable */\n", cp.Chunk))
+		workArgs.Logger.Printf("[stopOnChunkError] chunk %d err: %v, checkpoint: %s", cp.Chunk, result.Err, workArgs.CheckpointFile)
+	} else {
+		workArgs.Logger.Printf("[stopOnChunkError] chunk err: %v", result.Err)
+	}
+
+	os.Exit(result.ErrCode)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// clusterKey 返回目标表的聚簇索引列, 即 -target-dsn 中表的主键, 未设置 -target-dsn 时使用源表主键;
+// 按该顺序导出, 导入 InnoDB 时按顺序追加, 减少页分裂.
+func clusterKey(workArgs workArgsT) []string {
+	if len(workArgs.TargetDSN) == 0 {
+		return workArgs.PrimaryKey
+	}
+
+	driver := "mysql"
+	if workArgs.DbType == "postgres" {
+		driver = "postgres"
+	}
+	db, err := sql.Open(driver, workArgs.TargetDSN)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	targetArgs := workArgs
+	targetArgs.DB = db
+	return detectPrimaryKey(targetArgs, insertTable(workArgs))
+}
+
+// sameColumns 返回两组列是否相同且顺序一致
+func sameColumns(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// mysqlTLSConfigName 注册到 mysql 驱动的 TLS 配置名, -dsn 中可用 tls=custom 引用
+const mysqlTLSConfigName = "custom"
+
+// buildDSN 根据连接参数拼装驱动 DSN, 设置了 -dsn 时直接使用
+func buildDSN(workArgs workArgsT) (string, error) {
+	if workArgs.DbType == "mysql" {
+		tlsName, err := registerMysqlTLS(workArgs)
+		if err != nil {
+			return "", err
+		}
+
+		if len(workArgs.DSN) > 0 {
+			return workArgs.DSN, nil
+		}
+
+		cfg := mysql.NewConfig()
+		cfg.User = workArgs.DbUser
+		cfg.Passwd = workArgs.DbPassword
+		cfg.Net = "tcp"
+		cfg.Addr = workArgs.DbHost
+		if socket := dbSocket(workArgs); len(socket) > 0 {
+			cfg.Net = "unix"
+			cfg.Addr = socket
+		}
+		cfg.DBName = workArgs.Database
+		cfg.Params = map[string]string{"charset": workArgs.DbCharset}
+		if len(workArgs.SessionTimeZone) > 0 {
+			// 导出会话与导入会话使用同一时区, TIMESTAMP 列的值才不会偏移
+			cfg.Params["time_zone"] = "'" + workArgs.SessionTimeZone + "'"
+			// 时间列按会话时区解析, 输出的值与 SET time_zone 头一致
+			cfg.ParseTime = true
+			cfg.Loc, _ = loadTimeZone(workArgs.SessionTimeZone)
+		}
+		cfg.TLSConfig = tlsName
+
+		return cfg.FormatDSN(), nil
+	}
+
+	if len(workArgs.DSN) > 0 {
+		return workArgs.DSN, nil
+	}
+
+	query := url.Values{}
+	if mode := sslMode(workArgs); len(mode) > 0 {
+		query.Set("sslmode", mode)
+	}
+	if len(workArgs.DbSSLCa) > 0 {
+		query.Set("sslrootcert", workArgs.DbSSLCa)
+	}
+	if len(workArgs.DbSSLCert) > 0 {
+		query.Set("sslcert", workArgs.DbSSLCert)
+	}
+	if len(workArgs.DbSSLKey) > 0 {
+		query.Set("sslkey", workArgs.DbSSLKey)
+	}
+	if len(workArgs.SessionTimeZone) > 0 {
+		// pq 把未知参数作为会话参数发送
+		query.Set("timezone", workArgs.SessionTimeZone)
+	}
+	if len(workArgs.DbSchema) > 0 {
+		query.Set("search_path", workArgs.DbSchema)
+	}
+
+	host := workArgs.DbHost
+	if socket := dbSocket(workArgs); len(socket) > 0 {
+		// pq 通过 host 参数指定 unix socket 所在目录
+		host = ""
+		query.Set("host", socket)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(workArgs.DbUser, workArgs.DbPassword),
+		Host:     host,
+		Path:     "/" + workArgs.Database,
+		RawQuery: query.Encode(),
+	}
+
+	return dsn.String(), nil
+}
+
+// loadClientCredentials 未设置用户名或密码时, 从 ~/.my.cnf 或 ~/.pgpass(PGPASSFILE) 中读取;
+// 命令行上没有设置 -db-host 和 -db-name 时使用 my.cnf 中的 host, port, socket 和 database.
+func loadClientCredentials(workArgs *workArgsT) {
+	home, _ := os.UserHomeDir()
+	set := setFlags()
+
+	if workArgs.DbType == "mysql" {
+		conf, err := tools.ParseMyCnf(filepath.Join(home, ".my.cnf"))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("[loadClientCredentials] read my.cnf err: %v", err)
+			}
+			return
+		}
+
+		if workArgs.DbUser == "" {
+			workArgs.DbUser = conf["user"]
+		}
+		if workArgs.DbPassword == "" {
+			workArgs.DbPassword = conf["password"]
+		}
+		if !set["db-host"] && len(workArgs.DbSocket) == 0 {
+			if len(conf["socket"]) > 0 {
+				workArgs.DbSocket = conf["socket"]
+			} else if len(conf["host"]) > 0 || len(conf["port"]) > 0 {
+				host, port := conf["host"], conf["port"]
+				if host == "" {
+					host = "127.0.0.1"
+				}
+				if port == "" {
+					port = "3306"
+				}
+				workArgs.DbHost = net.JoinHostPort(host, port)
+			}
+		}
+		if !set["db-name"] && len(conf["database"]) > 0 {
+			workArgs.Database = conf["database"]
+		}
+		return
+	}
+
+	passFile := os.Getenv("PGPASSFILE")
+	if passFile == "" {
+		passFile = filepath.Join(home, ".pgpass")
+	}
+
+	// 与 libpq 一致, 其他用户可读的 .pgpass 不使用
+	if info, err := os.Stat(passFile); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		log.Printf("[loadClientCredentials] WARNING: password file %s has group or world access (%v), ignored; permissions should be u=rw (0600) or less", passFile, info.Mode().Perm())
+		return
+	}
+
+	host, port, err := net.SplitHostPort(workArgs.DbHost)
+	if err != nil {
+		host, port = workArgs.DbHost, "5432"
+	}
+	if len(dbSocket(*workArgs)) > 0 {
+		host = "localhost"
+	}
+
+	user, pwd, ok, err := tools.LookupPgPass(passFile, host, port, workArgs.Database, workArgs.DbUser)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[loadClientCredentials] read pgpass err: %v", err)
+		}
+		return
+	}
+
+	if ok {
+		workArgs.DbUser = user
+		if workArgs.DbPassword == "" {
+			workArgs.DbPassword = pwd
+		}
+	}
+}
+
+// dbSocket 返回 unix socket 路径, -db-socket 优先, 其次是以 / 开头的 -db-host
+func dbSocket(workArgs workArgsT) string {
+	if len(workArgs.DbSocket) > 0 {
+		return workArgs.DbSocket
+	}
+
+	if strings.HasPrefix(workArgs.DbHost, "/") {
+		return workArgs.DbHost
+	}
+
+	return ""
+}
+
+// sslMode 返回实际使用的 ssl 模式; 与 libpq 一致, 指定了 -db-ssl-ca 而模式为 require 或未设置时按 verify-ca 校验证书链, 不忽略 CA 证书
+func sslMode(workArgs workArgsT) string {
+	if len(workArgs.DbSSLCa) > 0 && (workArgs.DbSSLMode == "" || workArgs.DbSSLMode == "require") {
+		return "verify-ca"
+	}
+
+	return workArgs.DbSSLMode
+}
+
+// registerMysqlTLS 把 -db-ssl-* 参数转换为 mysql 驱动的 tls 参数值, 需要证书时注册自定义配置
+func registerMysqlTLS(workArgs workArgsT) (string, error) {
+	workArgs.DbSSLMode = sslMode(workArgs)
+	switch workArgs.DbSSLMode {
+	case "":
+		if len(workArgs.DbSSLCa) == 0 && len(workArgs.DbSSLCert) == 0 {
+			return "", nil
+		}
+	case "disable":
+		return "false", nil
+	case "prefer":
+		return "preferred", nil
+	case "require", "verify-ca", "verify-full":
+	default:
+		return "", fmt.Errorf("unknown ssl mode: %s", workArgs.DbSSLMode)
+	}
+
+	if workArgs.DbSSLMode == "require" && len(workArgs.DbSSLCert) == 0 {
+		return "skip-verify", nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if len(workArgs.DbSSLCa) > 0 {
+		pem, err := ioutil.ReadFile(workArgs.DbSSLCa)
+		if err != nil {
+			return "", err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("no certificate found in %s", workArgs.DbSSLCa)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(workArgs.DbSSLCert) > 0 || len(workArgs.DbSSLKey) > 0 {
+		cert, err := tls.LoadX509KeyPair(workArgs.DbSSLCert, workArgs.DbSSLKey)
+		if err != nil {
+			return "", err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch workArgs.DbSSLMode {
+	case "verify-full":
+		host, _, err := net.SplitHostPort(workArgs.DbHost)
+		if err != nil {
+			host = workArgs.DbHost
+		}
+		tlsConfig.ServerName = host
+	case "verify-ca":
+		// 只校验证书链, 不校验主机名
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyCertChain(tlsConfig.RootCAs)
+	default:
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	err := mysql.RegisterTLSConfig(mysqlTLSConfigName, tlsConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return mysqlTLSConfigName, nil
+}
+
+func verifyCertChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server sent no certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+// loadTimeZone 解析 -session-time-zone, 支持 +08:00 形式的偏移和 UTC, Asia/Shanghai 等时区名
+func loadTimeZone(name string) (*time.Location, error) {
+	if len(name) == 6 && (name[0] == '+' || name[0] == '-') && name[3] == ':' {
+		t, err := time.Parse("-07:00", name)
+		if err != nil {
+			return nil, err
+		}
+		_, offset := t.Zone()
+		return time.FixedZone(name, offset), nil
+	}
+
+	return time.LoadLocation(name)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// copyEscaper 转义 COPY 文本格式中的反斜杠, 分隔符和换行
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// copyHeader 返回 postgres COPY ... FROM stdin 数据块的开头
+func copyHeader(workArgs workArgsT, fields []string) string {
+	return fmt.Sprintf("COPY %s (%s) FROM stdin;\n", quoteTable(workArgs, insertTable(workArgs)), quoteIdents(workArgs, fields))
+}
+
+// copyRow 把一行数据转换为 COPY 文本格式, 列之间用 tab 分隔, NULL 写作 \N, bytea 写作 \x 十六进制
+func copyRow(workArgs workArgsT, columns []string, colTypes []string, fieldIdx []int, vals []interface{}, record map[string]interface{}) string {
+	var values []string
+	for _, k := range fieldIdx {
+		if vals[k] == nil {
+			values = append(values, `\N`)
+			continue
+		}
+		if b, ok := vals[k].([]byte); ok && strings.EqualFold(colTypes[k], "BYTEA") {
+			values = append(values, `\\x`+hex.EncodeToString(b))
+			continue
+		}
+
+		ve := renderValue(workArgs, vals[k], colTypes[k])
+		if workArgs.ValidateUTF8 {
+			ve = validateUTF8(workArgs, ve, columns[k], colTypes[k], record)
+		}
+		values = append(values, copyEscaper.Replace(ve))
+	}
+	if len(workArgs.SourceTagColumn) > 0 {
+		values = append(values, copyEscaper.Replace(workArgs.SourceTag))
+	}
+
+	return strings.Join(values, "\t") + "\n"
+}
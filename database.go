@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// writeCreateDatabase 在导出文件开头写出建库和切换库语句, 便于导入到新的服务器;
+// postgres 不能在事务脚本中建库和切换连接, 以注释形式给出.
+func writeCreateDatabase(workArgs workArgsT, output *os.File) {
+	var createSQL string
+
+	if workArgs.DbType == "postgres" {
+		var database, encoding string
+		err := workArgs.DB.QueryRow("SELECT current_database(), pg_encoding_to_char(encoding) FROM pg_database WHERE datname = current_database()").Scan(&database, &encoding)
+		if err != nil {
+			panic(err)
+		}
+		database = targetDatabase(workArgs, database)
+		createSQL = fmt.Sprintf("-- CREATE DATABASE %s ENCODING '%s';\n-- \\connect %s\n\n", quoteIdent(workArgs, database), encoding, quoteIdent(workArgs, database))
+	} else {
+		var database, charset, collation string
+		err := workArgs.DB.QueryRow("SELECT SCHEMA_NAME, DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = DATABASE()").Scan(&database, &charset, &collation)
+		if err != nil {
+			panic(err)
+		}
+		database = targetDatabase(workArgs, database)
+		createSQL = fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s DEFAULT CHARACTER SET %s COLLATE %s;\nUSE %s;\n\n", quoteIdent(workArgs, database), charset, collation, quoteIdent(workArgs, database))
+		if workArgs.CharsetMap != nil || workArgs.CollationMap != nil {
+			createSQL = tools.RewriteCharset(createSQL, workArgs.CharsetMap, workArgs.CollationMap)
+		}
+	}
+
+	log.Printf("[writeCreateDatabase] %s", createSQL)
+	_, _ = output.WriteString(createSQL)
+}
+
+// currentDatabase 返回当前连接的库名
+func currentDatabase(workArgs workArgsT) string {
+	querySQL := "SELECT DATABASE()"
+	if workArgs.DbType == "postgres" {
+		querySQL = "SELECT current_database()"
+	}
+
+	var database string
+	if err := workArgs.DB.QueryRow(querySQL).Scan(&database); err != nil {
+		panic(err)
+	}
+
+	return database
+}
+
+// targetDatabase 返回输出中使用的库名, 设置了 -target-db 时替换源库名
+func targetDatabase(workArgs workArgsT, database string) string {
+	if len(workArgs.TargetDB) > 0 {
+		return workArgs.TargetDB
+	}
+
+	return database
+}
+
+// rewriteDatabase 把语句中带源库名的标识符改为 -target-db; postgres 的库名不出现在标识符中, 不处理
+func rewriteDatabase(workArgs workArgsT, sql string) string {
+	if len(workArgs.TargetDB) == 0 || len(workArgs.SourceDatabase) == 0 || workArgs.DbType == "postgres" {
+		return sql
+	}
+
+	return tools.RewriteDatabase(sql, workArgs.SourceDatabase, workArgs.TargetDB)
+}
+
+// writeDisableChecks 在导出文件开头关闭外键和唯一性检查, 数据导入不受插入顺序影响; restore 为 true 时写出恢复语句
+func writeDisableChecks(workArgs workArgsT, output *os.File, restore bool) {
+	var checksSQL string
+
+	switch {
+	case workArgs.DbType == "postgres" && !restore:
+		// 需要超级用户权限, 同时会跳过触发器
+		checksSQL = "SET session_replication_role = replica;\n\n"
+	case workArgs.DbType == "postgres":
+		checksSQL = "SET session_replication_role = DEFAULT;\n"
+	case !restore:
+		checksSQL = "SET @OLD_FOREIGN_KEY_CHECKS=@@FOREIGN_KEY_CHECKS, FOREIGN_KEY_CHECKS=0;\nSET @OLD_UNIQUE_CHECKS=@@UNIQUE_CHECKS, UNIQUE_CHECKS=0;\n\n"
+	default:
+		checksSQL = "SET FOREIGN_KEY_CHECKS=@OLD_FOREIGN_KEY_CHECKS;\nSET UNIQUE_CHECKS=@OLD_UNIQUE_CHECKS;\n"
+	}
+
+	_, _ = output.WriteString(checksSQL)
+}
+
+// writeSessionHeader 写出导入会话的字符集, sql_mode 和时区, 不同默认配置的服务器上导入结果一致
+func writeSessionHeader(workArgs workArgsT, output *os.File) {
+	var sb strings.Builder
+
+	if workArgs.DbType == "postgres" {
+		if len(workArgs.SessionCharset) > 0 {
+			sb.WriteString(fmt.Sprintf("SET client_encoding = '%s';\n", workArgs.EscapeFunc(workArgs.SessionCharset)))
+		}
+		if len(workArgs.SessionTimeZone) > 0 {
+			sb.WriteString(fmt.Sprintf("SET TIME ZONE '%s';\n", workArgs.EscapeFunc(workArgs.SessionTimeZone)))
+		}
+		if len(workArgs.DbSchema) > 0 {
+			sb.WriteString(fmt.Sprintf("SET search_path = %s;\n", quoteIdents(workArgs, strings.Split(workArgs.DbSchema, ","))))
+		}
+	} else {
+		if len(workArgs.SessionCharset) > 0 {
+			sb.WriteString(fmt.Sprintf("SET NAMES %s;\n", workArgs.SessionCharset))
+		}
+		if workArgs.SessionSQLMode != "-" {
+			sb.WriteString(fmt.Sprintf("SET sql_mode = '%s';\n", workArgs.EscapeFunc(workArgs.SessionSQLMode)))
+		} else if workArgs.Escape == "ansi" {
+			// 字符串中的反斜杠不是转义符, 导入会话需要开启 NO_BACKSLASH_ESCAPES
+			sb.WriteString("SET sql_mode = CONCAT_WS(',', NULLIF(@@sql_mode, ''), 'NO_BACKSLASH_ESCAPES');\n")
+		}
+		if len(workArgs.SessionTimeZone) > 0 {
+			sb.WriteString(fmt.Sprintf("SET time_zone = '%s';\n", workArgs.EscapeFunc(workArgs.SessionTimeZone)))
+		}
+	}
+
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+		_, _ = output.WriteString(sb.String())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// dedupeSet 按指定列在客户端对导出行去重, 内存中最多保留 maxKeys 个键
+type dedupeSet struct {
+	columns []string
+	maxKeys int
+
+	mu     sync.Mutex
+	keys   map[string]struct{}
+	warned bool
+}
+
+func newDedupeSet(columns []string, maxKeys int) *dedupeSet {
+	return &dedupeSet{
+		columns: columns,
+		maxKeys: maxKeys,
+		keys:    make(map[string]struct{}),
+	}
+}
+
+// newTableDedupe 为一张(逻辑)表创建去重集合, 未设置 -dedupe-on 时返回 nil
+func newTableDedupe(workArgs workArgsT) *dedupeSet {
+	if len(workArgs.DedupeOn) == 0 {
+		return nil
+	}
+
+	return newDedupeSet(strings.Split(workArgs.DedupeOn, ","), workArgs.DedupeMaxKey)
+}
+
+// Missing 返回查询结果中不存在的去重列
+func (d *dedupeSet) Missing(columns []string) []string {
+	if d == nil {
+		return nil
+	}
+
+	var missing []string
+	for _, col := range d.columns {
+		if !tools.InArray(col, columns) {
+			missing = append(missing, col)
+		}
+	}
+
+	return missing
+}
+
+// Seen 返回该行的键是否已经出现过, 未出现过时记录下来
+func (d *dedupeSet) Seen(record map[string]interface{}) bool {
+	parts := make([]string, len(d.columns))
+	for i, col := range d.columns {
+		if record[col] == nil {
+			parts[i] = "\x01"
+			continue
+		}
+		parts[i] = rawValue(record[col])
+	}
+	key := strings.Join(parts, "\x00")
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.keys[key]; ok {
+		return true
+	}
+
+	if d.maxKeys > 0 && len(d.keys) >= d.maxKeys {
+		if !d.warned {
+			log.Printf("[dedupeSet] reach max keys: %d, new keys will not be deduped", d.maxKeys)
+			d.warned = true
+		}
+		return false
+	}
+
+	d.keys[key] = struct{}{}
+	return false
+}
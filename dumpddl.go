@@ -0,0 +1,409 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/internet-dev/db-export-tool/pkg/dump"
+)
+
+// 导出文件中表结构语句的方言转换, transform 模式下 -target-type 与 -db-type 不同时使用:
+// 转换 CREATE TABLE, DROP TABLE, CREATE INDEX 和 ALTER TABLE ADD CONSTRAINT, 会话设置等语句丢弃, 其他语句无法转换时跳过并告警.
+
+const dumpIdentPattern = "(?:`(?:[^`]|``)+`|\"(?:[^\"]|\"\")+\"|[\\w$]+)"
+
+var (
+	dumpIdentRe          = regexp.MustCompile(dumpIdentPattern)
+	dumpQualifiedPattern = dumpIdentPattern + "(?:\\." + dumpIdentPattern + ")?"
+
+	dumpCreateTableRe   = regexp.MustCompile(`(?is)^CREATE\s+(?:UNLOGGED\s+)?TABLE\s+(IF\s+NOT\s+EXISTS\s+)?(` + dumpQualifiedPattern + `)\s*\((.*)\)([^()]*)$`)
+	dumpDropTableRe     = regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(IF\s+EXISTS\s+)?(` + dumpQualifiedPattern + `)(?:\s+(?:CASCADE|RESTRICT))?$`)
+	dumpCreateIndexRe   = regexp.MustCompile(`(?is)^CREATE\s+(UNIQUE\s+)?INDEX\s+(?:IF\s+NOT\s+EXISTS\s+)?(` + dumpIdentPattern + `)\s+ON\s+(?:ONLY\s+)?(` + dumpQualifiedPattern + `)\s*(?:USING\s+\w+\s*)?\((.*)\)$`)
+	dumpAddConstraintRe = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:ONLY\s+)?(` + dumpQualifiedPattern + `)\s+ADD\s+CONSTRAINT\s+(` + dumpIdentPattern + `)\s+(.*)$`)
+	dumpReferencesRe    = regexp.MustCompile(`(?i)REFERENCES\s+(` + dumpQualifiedPattern + `)`)
+	// dumpSessionStmtRe 只影响导出时会话的语句, 转换方言时直接丢弃
+	dumpSessionStmtRe = regexp.MustCompile(`(?is)^(?:SET\s|LOCK\s+TABLES|UNLOCK\s+TABLES|SELECT\s+pg_catalog\.set_config|ALTER\s+.*\sOWNER\s+TO\s)`)
+
+	mysqlColumnTypeRe    = regexp.MustCompile(`(?i)^(\w+)(\s*\([^)]*\))?((?:\s+(?:unsigned|signed|zerofill))*)`)
+	mysqlKeyPrefixRe     = regexp.MustCompile("(`(?:[^`]|``)+`)\\s*\\(\\d+\\)")
+	mysqlIndexDefRe      = regexp.MustCompile("(?is)^(UNIQUE\\s+)?(?:KEY|INDEX)\\s+(" + dumpIdentPattern + ")\\s*(?:USING\\s+\\w+\\s*)?\\((.*)\\)")
+	mysqlColumnAttrsRe   = regexp.MustCompile(`(?i)\s+(?:(?:CHARACTER\s+SET|CHARSET|COLLATE)\s+\w+|COMMENT\s+'(?:[^'\\]|\\.|'')*'|ON\s+UPDATE\s+CURRENT_TIMESTAMP(?:\(\d*\))?)`)
+	mysqlIndexUsingRe    = regexp.MustCompile(`(?i)\s+USING\s+(?:BTREE|HASH)`)
+	pgColumnTypeRe       = regexp.MustCompile(`(?i)^(character\s+varying|character|bit\s+varying|double\s+precision|timestamp|time|[\w.]+)\b(\s*\(\d+(?:\s*,\s*\d+)?\))?(\s+with(?:out)?\s+time\s+zone)?(\[\])?`)
+	pgColumnAttrsRe      = regexp.MustCompile(`(?i)\s+(?:DEFAULT\s+nextval\([^)]*\)|GENERATED\s+(?:ALWAYS|BY\s+DEFAULT)\s+AS\s+IDENTITY(?:\s*\([^)]*\))?|COLLATE\s+\S+)`)
+	pgCastRe             = regexp.MustCompile(`::(?:"[^"]+"|[\w.]+)(?:\s+(?:varying|precision|with(?:out)?\s+time\s+zone))*(?:\(\d+(?:,\d+)?\))?(?:\[\])?`)
+	pgConstraintTailRe   = regexp.MustCompile(`(?i)\s+(?:NOT\s+VALID|NOT\s+DEFERRABLE|DEFERRABLE(?:\s+INITIALLY\s+(?:DEFERRED|IMMEDIATE))?)`)
+	pgNowRe              = regexp.MustCompile(`(?i)\bnow\(\)|\bCURRENT_TIMESTAMP\b(?:\(\d*\))?`)
+	mysqlAutoIncrementRe = regexp.MustCompile(`(?i)\s+AUTO_INCREMENT\b`)
+)
+
+// convertDumpStatement 把导出文件中 INSERT 以外的语句转换为 -target-type 的方言, 返回不含结尾分号的语句, 为空时不输出
+func convertDumpStatement(workArgs workArgsT, raw string) string {
+	body := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(dump.StripComments(raw, workArgs.DbType == "mysql")), ";"))
+	// 以下按目标方言加引号
+	workArgs.DbType = workArgs.TargetType
+	if len(body) == 0 || dumpSessionStmtRe.MatchString(body) {
+		return ""
+	}
+
+	if m := dumpCreateTableRe.FindStringSubmatch(body); m != nil {
+		return convertDumpCreateTable(workArgs, m[1], dumpTableName(m[2]), m[3])
+	}
+	if m := dumpDropTableRe.FindStringSubmatch(body); m != nil {
+		return fmt.Sprintf("DROP TABLE %s%s", m[1], quoteIdent(workArgs, dumpTableName(m[2])))
+	}
+	if m := dumpCreateIndexRe.FindStringSubmatch(body); m != nil {
+		tbl := dumpTableName(m[3])
+		return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", m[1], quoteIdent(workArgs, dumpTableName(m[2])), quoteIdent(workArgs, tbl),
+			convertDumpIdents(workArgs, stripMysqlKeyPrefix(m[4])))
+	}
+	if m := dumpAddConstraintRe.FindStringSubmatch(body); m != nil {
+		def := pgConstraintTailRe.ReplaceAllString(convertDumpConstraint(workArgs, m[3]), "")
+		return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s", quoteIdent(workArgs, dumpTableName(m[1])), quoteIdent(workArgs, dumpTableName(m[2])), def)
+	}
+
+	line := strings.SplitN(body, "\n", 2)[0]
+	workArgs.Logger.Printf("[convertDumpStatement] can not convert to %s, skip: %s", workArgs.TargetType, line)
+	workArgs.Summary.Warn()
+	return fmt.Sprintf("-- skipped, can not convert to %s: %s", workArgs.TargetType, line)
+}
+
+// convertDumpCreateTable 逐个转换建表语句中的列和表约束; mysql 的普通索引在 postgres 中单独建立
+func convertDumpCreateTable(workArgs workArgsT, ifNotExists string, tbl string, defs string) string {
+	var lines, indexes []string
+	for _, def := range splitTopLevel(defs) {
+		def = strings.TrimSpace(def)
+		upper := strings.ToUpper(def)
+
+		switch {
+		case len(def) == 0:
+		case strings.HasPrefix(upper, "FULLTEXT ") || strings.HasPrefix(upper, "SPATIAL "):
+			workArgs.Logger.Printf("[convertDumpCreateTable] %s: can not convert index, skip: %s", tbl, def)
+			workArgs.Summary.Warn()
+		case workArgs.TargetType == "postgres" && mysqlIndexDefRe.MatchString(def):
+			m := mysqlIndexDefRe.FindStringSubmatch(def)
+			name := dumpTableName(m[2])
+			columns := convertDumpIdents(workArgs, stripMysqlKeyPrefix(m[3]))
+			if len(m[1]) > 0 {
+				lines = append(lines, fmt.Sprintf("  CONSTRAINT %s UNIQUE (%s)", quoteIdent(workArgs, name), columns))
+				continue
+			}
+			// postgres 的索引名在 schema 内唯一, 不包含表名时以表名开头
+			if !strings.Contains(name, tbl) {
+				name = tbl + "_" + name
+			}
+			indexes = append(indexes, fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", ifNotExistsIndex(ifNotExists), quoteIdent(workArgs, name), quoteIdent(workArgs, tbl), columns))
+		case strings.HasPrefix(upper, "PRIMARY ") || strings.HasPrefix(upper, "UNIQUE ") || strings.HasPrefix(upper, "CONSTRAINT ") ||
+			strings.HasPrefix(upper, "CHECK ") || strings.HasPrefix(upper, "FOREIGN ") || strings.HasPrefix(upper, "KEY ") || strings.HasPrefix(upper, "INDEX "):
+			lines = append(lines, "  "+convertDumpConstraint(workArgs, def))
+		default:
+			lines = append(lines, "  "+convertDumpColumn(workArgs, def))
+		}
+	}
+
+	statements := []string{fmt.Sprintf("CREATE TABLE %s%s (\n%s\n)", ifNotExists, quoteIdent(workArgs, tbl), strings.Join(lines, ",\n"))}
+	if workArgs.TargetType == "mysql" {
+		statements[0] += " DEFAULT CHARSET=utf8mb4"
+	}
+
+	return strings.Join(append(statements, indexes...), ";\n")
+}
+
+func ifNotExistsIndex(ifNotExists string) string {
+	if len(ifNotExists) > 0 {
+		return "IF NOT EXISTS "
+	}
+
+	return ""
+}
+
+// convertDumpConstraint 转换表约束: 标识符引号, 外键引用的表去掉 schema, mysql 的索引前缀长度和索引方法, postgres 的类型转换
+func convertDumpConstraint(workArgs workArgsT, def string) string {
+	if workArgs.TargetType == "postgres" {
+		def = mysqlIndexUsingRe.ReplaceAllString(stripMysqlKeyPrefix(def), "")
+	} else {
+		def = mapUnquoted(def, false, func(s string) string {
+			return pgCastRe.ReplaceAllString(s, "")
+		})
+	}
+
+	def = dumpReferencesRe.ReplaceAllStringFunc(def, func(match string) string {
+		return "REFERENCES " + quoteIdent(workArgs, dumpTableName(dumpReferencesRe.FindStringSubmatch(match)[1]))
+	})
+
+	return convertDumpIdents(workArgs, def)
+}
+
+// convertDumpColumn 转换列定义: 列名, 类型和属性
+func convertDumpColumn(workArgs workArgsT, def string) string {
+	name := dumpIdentRe.FindString(def)
+	rest := strings.TrimSpace(strings.TrimPrefix(def, name))
+	name = quoteIdent(workArgs, dumpTableName(name))
+
+	if workArgs.TargetType == "postgres" {
+		m := mysqlColumnTypeRe.FindStringSubmatch(rest)
+		if m == nil {
+			return name + " " + rest
+		}
+		dataType := mysqlToPostgresType(m[1], strings.Replace(m[2], " ", "", -1), strings.Contains(strings.ToLower(m[3]), "unsigned"))
+		attrs := mysqlColumnAttrsRe.ReplaceAllString(rest[len(m[0]):], "")
+		if mysqlAutoIncrementRe.MatchString(attrs) {
+			attrs = mysqlAutoIncrementRe.ReplaceAllString(attrs, "")
+			dataType += " GENERATED BY DEFAULT AS IDENTITY"
+		}
+		return name + " " + dataType + attrs
+	}
+
+	m := pgColumnTypeRe.FindStringSubmatch(rest)
+	if m == nil {
+		return name + " " + rest
+	}
+	dataType := postgresToMysqlType(strings.Join(strings.Fields(m[1]), " "), strings.Replace(m[2], " ", "", -1), len(m[4]) > 0)
+	attrs := mapUnquoted(pgColumnAttrsRe.ReplaceAllString(rest[len(m[0]):], ""), false, func(s string) string {
+		s = pgCastRe.ReplaceAllString(s, "")
+		// mysql 的 DATETIME(n) 默认值的精度需要与列一致
+		if strings.HasPrefix(dataType, "datetime") {
+			s = pgNowRe.ReplaceAllString(s, "CURRENT_TIMESTAMP"+strings.TrimPrefix(dataType, "datetime"))
+		}
+		return s
+	})
+
+	return name + " " + dataType + attrs
+}
+
+// mysqlToPostgresType 把 mysql 列类型映射为 postgres 类型, 无符号整数使用更大的类型
+func mysqlToPostgresType(base string, args string, unsigned bool) string {
+	switch strings.ToLower(base) {
+	case "tinyint", "year":
+		return "smallint"
+	case "smallint":
+		if unsigned {
+			return "integer"
+		}
+		return "smallint"
+	case "mediumint":
+		return "integer"
+	case "int", "integer":
+		if unsigned {
+			return "bigint"
+		}
+		return "integer"
+	case "bigint":
+		if unsigned {
+			return "numeric(20)"
+		}
+		return "bigint"
+	case "float":
+		return "real"
+	case "double", "real":
+		return "double precision"
+	case "decimal", "numeric":
+		return "numeric" + args
+	case "char", "varchar", "bit", "time", "date":
+		return strings.ToLower(base) + args
+	case "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return "text"
+	case "tinyblob", "blob", "mediumblob", "longblob", "binary", "varbinary":
+		return "bytea"
+	case "datetime", "timestamp":
+		return "timestamp" + args
+	case "json":
+		return "json"
+	}
+
+	return base + args
+}
+
+// postgresToMysqlType 把 postgres 列类型映射为 mysql 类型, 无法对应的类型使用 longtext
+func postgresToMysqlType(base string, args string, array bool) string {
+	if array {
+		return "json"
+	}
+
+	switch strings.ToLower(base) {
+	case "smallint", "int2", "smallserial":
+		return "smallint"
+	case "integer", "int", "int4", "serial":
+		return "int"
+	case "bigint", "int8", "bigserial":
+		return "bigint"
+	case "numeric", "decimal":
+		if len(args) == 0 {
+			return "decimal(65,30)"
+		}
+		return "decimal" + args
+	case "real", "float4":
+		return "float"
+	case "double precision", "float8":
+		return "double"
+	case "character varying", "varchar":
+		if len(args) == 0 {
+			return "longtext"
+		}
+		return "varchar" + args
+	case "character", "char", "bpchar":
+		if len(args) == 0 {
+			return "char(1)"
+		}
+		return "char" + args
+	case "boolean", "bool":
+		return "tinyint(1)"
+	case "bytea":
+		return "longblob"
+	case "date":
+		return "date"
+	case "timestamp", "timestamptz":
+		// postgres 默认精确到微秒
+		if len(args) == 0 {
+			return "datetime(6)"
+		}
+		return "datetime" + args
+	case "time", "timetz":
+		if len(args) == 0 {
+			return "time(6)"
+		}
+		return "time" + args
+	case "json", "jsonb":
+		return "json"
+	case "uuid":
+		return "char(36)"
+	}
+
+	return "longtext"
+}
+
+// convertDumpIdents 把源方言引号中的标识符换成目标方言的引号, 字符串常量不变
+func convertDumpIdents(workArgs workArgsT, text string) string {
+	from := byte('"')
+	if workArgs.TargetType == "postgres" {
+		from = '`'
+	}
+
+	var sb strings.Builder
+	n := len(text)
+	for i := 0; i < n; i++ {
+		c := text[i]
+		switch c {
+		case '\'':
+			j := i + 1
+			for j < n && text[j] != '\'' {
+				if text[j] == '\\' && from == '`' {
+					j++
+				}
+				j++
+			}
+			if j >= n {
+				j = n - 1
+			}
+			sb.WriteString(text[i : j+1])
+			i = j
+		case from:
+			var ident strings.Builder
+			j := i + 1
+			for ; j < n; j++ {
+				if text[j] == from {
+					if j+1 < n && text[j+1] == from {
+						ident.WriteByte(from)
+						j++
+						continue
+					}
+					break
+				}
+				ident.WriteByte(text[j])
+			}
+			sb.WriteString(quoteIdent(workArgs, ident.String()))
+			i = j
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
+// mapUnquoted 对单引号字符串以外的部分调用 fn
+func mapUnquoted(text string, backslashEscapes bool, fn func(string) string) string {
+	var sb strings.Builder
+	start := 0
+	n := len(text)
+	for i := 0; i < n; i++ {
+		if text[i] != '\'' {
+			continue
+		}
+		sb.WriteString(fn(text[start:i]))
+		j := i + 1
+		for j < n {
+			if text[j] == '\\' && backslashEscapes {
+				j += 2
+				continue
+			}
+			if text[j] == '\'' {
+				if j+1 < n && text[j+1] == '\'' {
+					j += 2
+					continue
+				}
+				break
+			}
+			j++
+		}
+		if j >= n {
+			j = n - 1
+		}
+		sb.WriteString(text[i : j+1])
+		start, i = j+1, j
+	}
+	sb.WriteString(fn(text[start:]))
+
+	return sb.String()
+}
+
+// splitTopLevel 以括号和引号之外的逗号分隔
+func splitTopLevel(text string) []string {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '\'' && i+1 < len(text) {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, text[start:])
+}
+
+// stripMysqlKeyPrefix 去掉索引列的前缀长度, 如 `name`(10)
+func stripMysqlKeyPrefix(text string) string {
+	return mysqlKeyPrefixRe.ReplaceAllString(text, "$1")
+}
+
+// dumpTableName 返回去掉引号和 schema 的名称, 与 INSERT 中的表名一致
+func dumpTableName(name string) string {
+	parts := dumpIdentRe.FindAllString(name, -1)
+	if len(parts) == 0 {
+		return name
+	}
+
+	last := parts[len(parts)-1]
+	if len(last) > 1 && (last[0] == '`' || last[0] == '"') {
+		q := string(last[0])
+		return strings.Replace(last[1:len(last)-1], q+q, q, -1)
+	}
+
+	return last
+}
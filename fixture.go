@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// fixtureValue 带类型的列值, 回放时还原为驱动返回的原始类型
+type fixtureValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v,omitempty"`
+}
+
+// fixtureQuery 一次查询及其结果
+type fixtureQuery struct {
+	Query        string           `json:"query"`
+	Args         []fixtureValue   `json:"args,omitempty"`
+	Columns      []string         `json:"columns,omitempty"`
+	Types        []string         `json:"types,omitempty"`
+	Rows         [][]fixtureValue `json:"rows,omitempty"`
+	RowsAffected int64            `json:"rows_affected,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// fixtureStore -record 时按执行顺序保存查询, -replay 时按查询和参数取回结果;
+// 同一查询执行多次时按顺序回放, 用完后重复最后一次的结果.
+type fixtureStore struct {
+	mu      sync.Mutex
+	queries []fixtureQuery
+	replay  map[string][]fixtureQuery
+}
+
+func loadFixtures(filename string) (*fixtureStore, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &fixtureStore{replay: make(map[string][]fixtureQuery)}
+	if err = json.Unmarshal(data, &store.queries); err != nil {
+		return nil, err
+	}
+	for _, q := range store.queries {
+		key := fixtureKey(q.Query, q.Args)
+		store.replay[key] = append(store.replay[key], q)
+	}
+
+	return store, nil
+}
+
+// Save 写出录制的查询, 先写临时文件再改名
+func (s *fixtureStore) Save(filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s.queries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
+
+func (s *fixtureStore) add(q fixtureQuery) {
+	s.mu.Lock()
+	s.queries = append(s.queries, q)
+	s.mu.Unlock()
+}
+
+func (s *fixtureStore) find(query string, args []fixtureValue) (fixtureQuery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fixtureKey(query, args)
+	queue := s.replay[key]
+	if len(queue) == 0 {
+		return fixtureQuery{}, fmt.Errorf("no fixture for query: %s", query)
+	}
+	if len(queue) > 1 {
+		s.replay[key] = queue[1:]
+	}
+
+	return queue[0], nil
+}
+
+func fixtureKey(query string, args []fixtureValue) string {
+	parts := []string{query}
+	for _, arg := range args {
+		parts = append(parts, arg.Type+":"+arg.Value)
+	}
+
+	return strings.Join(parts, "\x00")
+}
+
+// encodeFixtureValue 把驱动返回的值转换为可写入 json 的形式
+func encodeFixtureValue(val interface{}) fixtureValue {
+	switch v := val.(type) {
+	case nil:
+		return fixtureValue{Type: "null"}
+	case []byte:
+		if utf8.Valid(v) {
+			return fixtureValue{Type: "bytes", Value: string(v)}
+		}
+		return fixtureValue{Type: "base64", Value: base64.StdEncoding.EncodeToString(v)}
+	case string:
+		return fixtureValue{Type: "string", Value: v}
+	case int64:
+		return fixtureValue{Type: "int", Value: strconv.FormatInt(v, 10)}
+	case float64:
+		return fixtureValue{Type: "float", Value: strconv.FormatFloat(v, 'g', -1, 64)}
+	case bool:
+		return fixtureValue{Type: "bool", Value: strconv.FormatBool(v)}
+	case time.Time:
+		return fixtureValue{Type: "time", Value: v.Format(time.RFC3339Nano)}
+	default:
+		return fixtureValue{Type: "string", Value: fmt.Sprint(v)}
+	}
+}
+
+func decodeFixtureValue(v fixtureValue) (driver.Value, error) {
+	switch v.Type {
+	case "null":
+		return nil, nil
+	case "bytes":
+		return []byte(v.Value), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(v.Value)
+	case "string":
+		return v.Value, nil
+	case "int":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(v.Value, 64)
+	case "bool":
+		return strconv.ParseBool(v.Value)
+	case "time":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	default:
+		return nil, fmt.Errorf("unknown fixture value type: %s", v.Type)
+	}
+}
+
+func encodeFixtureArgs(args []driver.NamedValue) []fixtureValue {
+	var values []fixtureValue
+	for _, arg := range args {
+		values = append(values, encodeFixtureValue(arg.Value))
+	}
+
+	return values
+}
+
+// fixtureConnector 实现 driver.Connector; db 不为空时录制, 查询转发到真实连接, 否则从 store 回放
+type fixtureConnector struct {
+	db    *sql.DB
+	store *fixtureStore
+}
+
+func (c *fixtureConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fixtureConn{c}, nil
+}
+
+func (c *fixtureConnector) Driver() driver.Driver {
+	return fixtureDriver{}
+}
+
+type fixtureDriver struct{}
+
+func (fixtureDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fixture driver must be opened with sql.OpenDB")
+}
+
+type fixtureConn struct {
+	c *fixtureConnector
+}
+
+func (conn *fixtureConn) Prepare(query string) (driver.Stmt, error) {
+	return &fixtureStmt{conn, query}, nil
+}
+
+func (conn *fixtureConn) Close() error {
+	return nil
+}
+
+func (conn *fixtureConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fixture driver does not support transactions")
+}
+
+func (conn *fixtureConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, err := conn.run(ctx, query, args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fixtureRows{q: q}, nil
+}
+
+func (conn *fixtureConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	q, err := conn.run(ctx, query, args, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(q.RowsAffected), nil
+}
+
+// run 录制时执行真实查询并把结果整体读入内存, 只适合录制测试用的小数据集
+func (conn *fixtureConn) run(ctx context.Context, query string, args []driver.NamedValue, exec bool) (fixtureQuery, error) {
+	q := fixtureQuery{Query: query, Args: encodeFixtureArgs(args)}
+	if conn.c.db == nil {
+		found, err := conn.c.store.find(query, q.Args)
+		if err != nil {
+			return found, err
+		}
+		if len(found.Error) > 0 {
+			return found, errors.New(found.Error)
+		}
+		return found, nil
+	}
+
+	values := make([]interface{}, len(args))
+	for k, arg := range args {
+		values[k] = arg.Value
+	}
+
+	var err error
+	if exec {
+		err = recordExec(ctx, conn.c.db, &q, values)
+	} else {
+		err = recordQuery(ctx, conn.c.db, &q, values)
+	}
+	if err != nil {
+		q.Error = err.Error()
+	}
+	conn.c.store.add(q)
+
+	return q, err
+}
+
+func recordExec(ctx context.Context, db *sql.DB, q *fixtureQuery, values []interface{}) error {
+	res, err := db.ExecContext(ctx, q.Query, values...)
+	if err != nil {
+		return err
+	}
+	q.RowsAffected, _ = res.RowsAffected()
+
+	return nil
+}
+
+func recordQuery(ctx context.Context, db *sql.DB, q *fixtureQuery, values []interface{}) error {
+	rows, err := db.QueryContext(ctx, q.Query, values...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	q.Columns, _ = rows.Columns()
+	types, _ := rows.ColumnTypes()
+	for _, ct := range types {
+		q.Types = append(q.Types, ct.DatabaseTypeName())
+	}
+
+	for rows.Next() {
+		refs := make([]interface{}, len(q.Columns))
+		for i := range refs {
+			var ref interface{}
+			refs[i] = &ref
+		}
+		if err = rows.Scan(refs...); err != nil {
+			return err
+		}
+
+		row := make([]fixtureValue, len(refs))
+		for k := range refs {
+			row[k] = encodeFixtureValue(reflect.Indirect(reflect.ValueOf(refs[k])).Interface())
+		}
+		q.Rows = append(q.Rows, row)
+	}
+
+	return rows.Err()
+}
+
+type fixtureStmt struct {
+	conn  *fixtureConn
+	query string
+}
+
+func (stmt *fixtureStmt) Close() error {
+	return nil
+}
+
+func (stmt *fixtureStmt) NumInput() int {
+	return -1
+}
+
+func (stmt *fixtureStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return stmt.conn.ExecContext(context.Background(), stmt.query, namedValues(args))
+}
+
+func (stmt *fixtureStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return stmt.conn.QueryContext(context.Background(), stmt.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for k, arg := range args {
+		named[k] = driver.NamedValue{Ordinal: k + 1, Value: arg}
+	}
+
+	return named
+}
+
+type fixtureRows struct {
+	q   fixtureQuery
+	pos int
+}
+
+func (r *fixtureRows) Columns() []string {
+	return r.q.Columns
+}
+
+func (r *fixtureRows) Close() error {
+	return nil
+}
+
+func (r *fixtureRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.q.Rows) {
+		return io.EOF
+	}
+
+	for k, v := range r.q.Rows[r.pos] {
+		value, err := decodeFixtureValue(v)
+		if err != nil {
+			return err
+		}
+		dest[k] = value
+	}
+	r.pos++
+
+	return nil
+}
+
+func (r *fixtureRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.q.Types) {
+		return r.q.Types[index]
+	}
+
+	return ""
+}
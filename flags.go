@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// orderByFlag -order-by=table:col1,col2, 可重复设置多个表
+type orderByFlag map[string][]string
+
+func (f orderByFlag) String() string {
+	var items []string
+	for table, cols := range f {
+		items = append(items, table+":"+strings.Join(cols, ","))
+	}
+	sort.Strings(items)
+
+	return strings.Join(items, " ")
+}
+
+func (f orderByFlag) Set(value string) error {
+	kv := strings.SplitN(value, ":", 2)
+	if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+		return fmt.Errorf("invalid order by: %s, format: table:col1,col2", value)
+	}
+
+	f[kv[0]] = strings.Split(kv[1], ",")
+	return nil
+}
+
+// kvFlag -flag=key=value, 可重复设置
+type kvFlag map[string]string
+
+func (f kvFlag) String() string {
+	var items []string
+	for k, v := range f {
+		items = append(items, k+"="+v)
+	}
+	sort.Strings(items)
+
+	return strings.Join(items, " ")
+}
+
+func (f kvFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || len(kv[0]) == 0 {
+		return fmt.Errorf("invalid value: %s, format: key=value", value)
+	}
+
+	f[kv[0]] = kv[1]
+	return nil
+}
+
+var (
+	// flagAliases 短参数名 -> 参数名
+	flagAliases = make(map[string]string)
+	// deprecatedFlags 已废弃的参数名 -> 替代的参数名
+	deprecatedFlags = make(map[string]string)
+	// hiddenFlags 不在帮助信息中显示的参数
+	hiddenFlags = make(map[string]bool)
+)
+
+// flagGroups 帮助信息中参数的分组, 未列出的参数显示在 Other 中
+var flagGroups = []struct {
+	Title string
+	Names []string
+}{
+	{"Connection", []string{"db-type", "db-name", "db-host", "db-user", "db-password", "db-password-file", "ask-pass", "db-charset", "db-socket",
+		"db-schema", "db-ssl-mode", "db-ssl-ca", "db-ssl-cert", "db-ssl-key", "dsn", "source", "source-tag-column",
+		"record", "replay"}},
+	{"Selection", []string{"preset", "model", "table", "table-regex", "exclude-table", "priority", "changed-since", "where", "skip-field", "only-field",
+		"limit", "sample", "distinct", "dedupe-on", "dedupe-max-keys", "shard", "table-query",
+		"as-of", "validity-columns", "history"}},
+	{"Data export", []string{"chunk", "chunk-checksum", "max-rows-per-second", "max-bytes-per-second", "chunk-anomaly-factor", "chunk-anomaly-webhook", "order-by", "cluster-order", "parallel", "incremental-column", "since", "state-file",
+		"max-duration", "checkpoint-file", "outfile-dir", "outfile-local-dir", "target-dsn", "target-ddl", "mask", "mask-file", "backfill",
+		"column-group-size", "rows-per-insert", "extended-insert", "max-statement-bytes", "insert-mode", "upsert", "truncate-before-insert", "delete-before-insert"}},
+	{"Output", []string{"output", "max-total-rows", "max-total-bytes", "force", "prime-script", "input", "format", "target-type", "line-ending", "bom", "date-format", "timestamp-format",
+		"validate-utf8", "fix-utf8", "json-cast", "if-not-exists", "rename-table", "table-prefix", "keep-auto-increment", "add-create-database", "target-db", "escape", "session-charset", "session-sql-mode", "session-time-zone",
+		"disable-checks", "source-position", "strip-definer", "rewrite-definer", "rewrite-charset", "rewrite-collation", "rewrite-engine", "strip-password", "lineage-format", "column-lineage", "lint-varchar-max"}},
+	{"Mydumper layout", []string{"mydumper-dir", "mydumper-file-size"}},
+	{"Bundle", []string{"bundle", "bundle-dir", "bundle-dataset", "bundle-s3-prefix", "column-stats"}},
+}
+
+// flagAlias 注册参数的短名, 与原参数共用同一个值
+func flagAlias(alias, name string) {
+	flag.Var(flag.Lookup(name).Value, alias, "alias of -"+name)
+	flagAliases[alias] = name
+}
+
+// deprecatedFlag 保留已废弃的参数名, 与替代参数共用同一个值, 使用时给出提示
+func deprecatedFlag(old, name string) {
+	flag.Var(flag.Lookup(name).Value, old, "deprecated, use -"+name)
+	deprecatedFlags[old] = name
+}
+
+// hiddenFlag 在帮助信息中隐藏测试用的参数
+func hiddenFlag(names ...string) {
+	for _, name := range names {
+		hiddenFlags[name] = true
+	}
+}
+
+// setFlags 返回命令行上设置过的参数, 短名和废弃的参数名同时记为对应的参数名
+func setFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if name, ok := flagAliases[f.Name]; ok {
+			set[name] = true
+		}
+		if name, ok := deprecatedFlags[f.Name]; ok {
+			set[name] = true
+		}
+	})
+
+	return set
+}
+
+// warnDeprecatedFlags 在 flag.Parse 之后检查是否使用了废弃的参数名
+func warnDeprecatedFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		if name, ok := deprecatedFlags[f.Name]; ok {
+			log.Printf("[warnDeprecatedFlags] -%s is deprecated and will be removed, use -%s", f.Name, name)
+		}
+	})
+}
+
+// printFlagGroups 按分组输出参数说明, 短名附在分组之后, 废弃和隐藏的参数不显示
+func printFlagGroups() {
+	grouped := make(map[string]bool)
+	printGroup := func(title string, names []string) {
+		if len(names) == 0 {
+			return
+		}
+
+		fs := flag.NewFlagSet(title, flag.ContinueOnError)
+		fs.SetOutput(os.Stdout)
+		for _, name := range names {
+			if f := flag.Lookup(name); f != nil {
+				fs.Var(f.Value, f.Name, f.Usage)
+				grouped[name] = true
+			}
+		}
+
+		_, _ = fmt.Fprintf(os.Stdout, "\n%s:\n", title)
+		fs.PrintDefaults()
+	}
+
+	for _, group := range flagGroups {
+		printGroup(group.Title, group.Names)
+	}
+
+	var others []string
+	flag.VisitAll(func(f *flag.Flag) {
+		_, isAlias := flagAliases[f.Name]
+		_, isDeprecated := deprecatedFlags[f.Name]
+		if !grouped[f.Name] && !isAlias && !isDeprecated && !hiddenFlags[f.Name] && f.Name != "h" {
+			others = append(others, f.Name)
+		}
+	})
+	printGroup("Other", others)
+
+	var aliases []string
+	for alias, name := range flagAliases {
+		aliases = append(aliases, fmt.Sprintf("  -%s = -%s", alias, name))
+	}
+	sort.Strings(aliases)
+	_, _ = fmt.Fprintf(os.Stdout, "\nAliases:\n%s\n", strings.Join(aliases, "\n"))
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/internet-dev/db-export-tool/pkg/dump"
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// doWorkFromDump 读取已有的 SQL 导出文件, 把其中的 INSERT 数据转换为 csv/jsonl, 不需要连接数据库
+func doWorkFromDump(workArgs workArgsT, output *os.File) {
+	workArgs.Logger.Printf("[doWorkFromDump] start work, input: %s", workArgs.Input)
+
+	csvWriter := csv.NewWriter(output)
+	csvWriter.UseCRLF = workArgs.LineEnding == "crlf"
+	var lastTable string
+	var rowsNum int
+	jsonColumns := make(map[string]map[string]bool)
+
+	forEachDumpStatement(workArgs, func(stmt *dump.Statement, fields []string) {
+		if stmt.Insert == nil {
+			for table, cols := range parseJSONColumns(stmt.Raw) {
+				jsonColumns[table] = cols
+			}
+			return
+		}
+
+		insert := stmt.Insert
+		for _, values := range insert.Rows {
+			if workArgs.Format == "csv" {
+				if insert.Table != lastTable {
+					// csv 只有一个表头, 不能混合多张表的行
+					if len(lastTable) > 0 {
+						csvWriter.Flush()
+						errMsg(fmt.Sprintf("dump has rows of %s and %s, csv holds one table, select it with -table or use -format=jsonl", lastTable, insert.Table), 13)
+					}
+					_ = csvWriter.Write(fields)
+				}
+				record := make([]string, len(values))
+				for k, value := range values {
+					if !value.Null {
+						record[k] = value.Text
+					}
+				}
+				_ = csvWriter.Write(record)
+			} else {
+				_, _ = output.Write(dumpRowJSON(insert.Table, fields, values, jsonColumns[insert.Table]))
+				if workArgs.LineEnding == "crlf" {
+					_, _ = output.WriteString("\r\n")
+				} else {
+					_, _ = output.WriteString("\n")
+				}
+			}
+
+			lastTable = insert.Table
+			rowsNum++
+		}
+	})
+
+	csvWriter.Flush()
+	if errF := csvWriter.Error(); errF != nil {
+		workArgs.Logger.Printf("[doWorkFromDump] write err: %v", errF)
+	}
+
+	workArgs.Logger.Printf("[doWorkFromDump] jobs have done, rows: %d", rowsNum)
+}
+
+// forEachDumpStatement 逐条读取 -input 导出文件, 按 -table, -table-regex 和 -exclude-table 过滤表, 按 -skip-field, -only-field 去掉 INSERT 中的列.
+// fn 收到的 INSERT 的 Rows 已经去掉了跳过的列并按 -mask 脱敏, fields 为对应的列名; 其他语句 fields 为 nil.
+func forEachDumpStatement(workArgs workArgsT, fn func(stmt *dump.Statement, fields []string)) {
+	f, err := os.Open(workArgs.Input)
+	if err != nil {
+		errMsg(fmt.Sprintf("can not read dump file: %s, err: %v", workArgs.Input, err), 30)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	skipFields := strings.Split(workArgs.SkipField, ",")
+	var onlyFields []string
+	if len(workArgs.OnlyField) > 0 {
+		onlyFields = strings.Split(workArgs.OnlyField, ",")
+	}
+	createColumns := make(map[string][]string)
+
+	scanner := dump.NewScanner(f, workArgs.DbType == "mysql")
+	for {
+		stmt, errN := scanner.Next()
+		if errN == io.EOF {
+			break
+		}
+		if errN != nil {
+			errMsg(fmt.Sprintf("can not parse dump file: %s, err: %v", workArgs.Input, errN), 32)
+		}
+
+		if stmt.Insert == nil {
+			for table, cols := range parseCreateTables(stmt.Raw) {
+				createColumns[table] = cols
+			}
+			if table := dumpStatementTable(stmt.Raw, workArgs.DbType == "mysql"); len(table) > 0 && !tableSelected(workArgs, table) {
+				continue
+			}
+			fn(stmt, nil)
+			continue
+		}
+
+		insert := stmt.Insert
+		if !tableSelected(workArgs, insert.Table) {
+			continue
+		}
+		if len(insert.Rows) == 0 || len(insert.Rows[0]) == 0 {
+			// VALUES () 没有可以转换的列值, 作为普通语句处理
+			stmt.Insert = nil
+			fn(stmt, nil)
+			continue
+		}
+
+		columns := insert.Columns
+		if len(columns) == 0 {
+			columns = createColumns[insert.Table]
+		}
+
+		var fields []string
+		var keep []int
+		for k := range insert.Rows[0] {
+			col := fmt.Sprintf("col%d", k+1)
+			if k < len(columns) {
+				col = columns[k]
+			}
+			if tools.InArray(col, skipFields) || (onlyFields != nil && !tools.InArray(col, onlyFields)) {
+				continue
+			}
+			fields = append(fields, col)
+			keep = append(keep, k)
+		}
+
+		masked := workArgs.Masker.Columns(insert.Table, fields)
+		for r, row := range insert.Rows {
+			values := make([]dump.Value, len(keep))
+			for i, k := range keep {
+				if k < len(row) {
+					values[i] = row[k]
+				}
+			}
+			if len(masked) > 0 {
+				workArgs.Masker.ApplyDump(insert.Table, masked, fields, values)
+			}
+			insert.Rows[r] = values
+		}
+
+		fn(stmt, fields)
+	}
+}
+
+// dumpStatementTable 返回 DROP/CREATE/ALTER/LOCK/TRUNCATE 等语句操作的表名, 无法识别时返回空
+func dumpStatementTable(raw string, mysql bool) string {
+	body := strings.TrimSpace(dump.StripComments(raw, mysql))
+	m := dumpTableStmtRe.FindStringSubmatch(body)
+	if m == nil {
+		return ""
+	}
+
+	name := strings.NewReplacer("`", "", `"`, "").Replace(m[1])
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+
+	return name
+}
+
+var dumpTableStmtRe = regexp.MustCompile("(?is)^(?:DROP\\s+TABLE(?:\\s+IF\\s+EXISTS)?|CREATE\\s+TABLE(?:\\s+IF\\s+NOT\\s+EXISTS)?|ALTER\\s+TABLE(?:\\s+ONLY)?|LOCK\\s+TABLES|TRUNCATE(?:\\s+TABLE)?)\\s+((?:[`\"]?[\\w$]+[`\"]?\\.)?[`\"]?[\\w$]+[`\"]?)")
+
+// dumpDatabaseStmtRe 导出文件中的 USE 和 CREATE DATABASE 语句, 如 mysqldump 的 CREATE DATABASE /*!32312 IF NOT EXISTS*/ `db`
+var dumpDatabaseStmtRe = regexp.MustCompile("(?im)^(\\s*(?:USE|CREATE\\s+(?:DATABASE|SCHEMA))\\b[^`;\\n]*)`((?:[^`]|``)+)`")
+
+// doWorkTransform 流式读取已有的 SQL 导出文件, 过滤表和列, 按 -target-type 的方言重新生成 INSERT,
+// 方言不同时转换表结构语句 (convertDumpStatement), 否则其他语句原样输出;
+// 设置 -target-db 时源库名取 -db-name 或导出文件中的 USE/CREATE DATABASE.
+func doWorkTransform(workArgs workArgsT, output *os.File) {
+	workArgs.Logger.Printf("[doWorkTransform] start work, input: %s", workArgs.Input)
+
+	source := workArgs.Database
+	var rowsNum int
+	forEachDumpStatement(workArgs, func(stmt *dump.Statement, fields []string) {
+		if stmt.Insert == nil {
+			raw := stmt.Raw
+			if len(workArgs.TargetDB) > 0 {
+				raw = dumpDatabaseStmtRe.ReplaceAllStringFunc(raw, func(match string) string {
+					m := dumpDatabaseStmtRe.FindStringSubmatch(match)
+					source = strings.Replace(m[2], "``", "`", -1)
+					return m[1] + "`" + strings.Replace(workArgs.TargetDB, "`", "``", -1) + "`"
+				})
+				if len(source) > 0 {
+					raw = tools.RewriteDatabase(raw, source, workArgs.TargetDB)
+				}
+			}
+			if workArgs.StripDefiner || len(workArgs.RewriteDefiner) > 0 {
+				raw = tools.RewriteDefiner(raw, workArgs.RewriteDefiner)
+			}
+			if workArgs.CharsetMap != nil || workArgs.CollationMap != nil {
+				raw = tools.RewriteCharset(raw, workArgs.CharsetMap, workArgs.CollationMap)
+			}
+			if workArgs.EngineMap != nil {
+				raw = tools.RewriteEngine(raw, workArgs.EngineMap)
+			}
+			if workArgs.TargetType != workArgs.DbType {
+				if raw = convertDumpStatement(workArgs, raw); len(raw) == 0 {
+					return
+				}
+				raw += ";\n"
+			}
+			_, _ = output.WriteString(strings.TrimLeft(raw, "\n") + "\n")
+			return
+		}
+
+		insert := renderDumpInsert(workArgs, stmt.Insert.Table, fields, stmt.Insert.Rows)
+		if len(stmt.Insert.Tail) > 0 {
+			// ON DUPLICATE KEY UPDATE/ON CONFLICT 引用的列和语法属于源方言, 只在方言相同时保留
+			if workArgs.TargetType == workArgs.DbType {
+				insert = strings.TrimSuffix(insert, ";\n\n") + "\n" + stmt.Insert.Tail + ";\n\n"
+			} else {
+				workArgs.Logger.Printf("[doWorkTransform] %s: drop clause after VALUES, can not convert to %s: %s", stmt.Insert.Table, workArgs.TargetType, stmt.Insert.Tail)
+				workArgs.Summary.Warn()
+			}
+		}
+		_, _ = output.WriteString(insert)
+		rowsNum += len(stmt.Insert.Rows)
+	})
+
+	workArgs.Logger.Printf("[doWorkTransform] jobs have done, rows: %d", rowsNum)
+}
+
+// renderDumpInsert 按目标方言生成 INSERT 语句
+func renderDumpInsert(workArgs workArgsT, table string, fields []string, rows [][]dump.Value) string {
+	quote, escape := "`", tools.AddSlashes
+	if workArgs.TargetType == "postgres" {
+		quote, escape = `"`, tools.PgEscape
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("INSERT INTO %s%s%s (%s%s%s) VALUES\n", quote, table, quote, quote, strings.Join(fields, quote+", "+quote), quote))
+	for r, row := range rows {
+		if r > 0 {
+			sb.WriteString(",\n")
+		}
+
+		values := make([]string, len(row))
+		for k, value := range row {
+			switch {
+			case value.Null:
+				values[k] = "NULL"
+			case value.Quoted:
+				values[k] = fmt.Sprintf(`'%s'`, escape(value.Text))
+			default:
+				values[k] = value.Text
+			}
+		}
+		sb.WriteString(fmt.Sprintf("(%s)", strings.Join(values, ", ")))
+	}
+	sb.WriteString(";\n\n")
+
+	return sb.String()
+}
+
+// dumpRowJSON 按列顺序输出一行 {"table": ..., "row": {...}}, 不含换行, 未加引号的数字和布尔值保留原类型, jsonCols 中的列输出为嵌套 JSON
+func dumpRowJSON(table string, fields []string, values []dump.Value, jsonCols map[string]bool) []byte {
+	var buf bytes.Buffer
+
+	name, _ := json.Marshal(table)
+	buf.WriteString(`{"table":`)
+	buf.Write(name)
+	buf.WriteString(`,"row":{`)
+
+	for k, field := range fields {
+		if k > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		value := values[k]
+		switch {
+		case value.Null:
+			buf.WriteString("null")
+		case !value.Quoted && (strings.EqualFold(value.Text, "TRUE") || strings.EqualFold(value.Text, "FALSE")):
+			buf.WriteString(strings.ToLower(value.Text))
+		case !value.Quoted && isJSONNumber(value.Text):
+			buf.WriteString(value.Text)
+		case jsonCols[field] && json.Valid([]byte(value.Text)):
+			buf.WriteString(value.Text)
+		default:
+			text, _ := json.Marshal(value.Text)
+			buf.Write(text)
+		}
+	}
+	buf.WriteString("}}")
+
+	return buf.Bytes()
+}
+
+func isJSONNumber(text string) bool {
+	if _, err := strconv.ParseFloat(text, 64); err != nil {
+		return false
+	}
+
+	return json.Valid([]byte(text))
+}
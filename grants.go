@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// grantPasswordRe SHOW CREATE USER 中的密码哈希, 如 IDENTIFIED WITH 'caching_sha2_password' AS '...'
+	grantPasswordRe = regexp.MustCompile(`\s+(?:AS|BY PASSWORD)\s+'(?:[^'\\]|\\.|'')*'`)
+	// grantTargetRe GRANT ... ON target TO, 用于过滤其他库上的权限
+	grantTargetRe = regexp.MustCompile("(?i)\\sON\\s+(?:TABLE\\s+|FUNCTION\\s+|PROCEDURE\\s+)?(\\S+)\\s+TO\\s")
+)
+
+// doWorkExportGrants 导出在当前库上有权限的账号和角色的 CREATE USER/ROLE 和 GRANT 语句
+func doWorkExportGrants(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkExportGrants] start work")
+
+	var statements []string
+	if workArgs.DbType == "postgres" {
+		statements = postgresGrants(workArgs)
+	} else {
+		statements = mysqlGrants(workArgs)
+	}
+
+	for _, stmt := range statements {
+		_, _ = output.WriteString(stmt + ";\n")
+	}
+	_, _ = output.WriteString("\n")
+
+	log.Printf("[doWorkExportGrants] jobs have done, statements: %d", len(statements))
+}
+
+// queryStrings 执行只返回一列的查询
+func queryStrings(workArgs workArgsT, querySQL string, args ...interface{}) []string {
+	log.Printf("[queryStrings] sql: %s", querySQL)
+
+	rows, err := workArgs.DB.Query(querySQL, args...)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if errS := rows.Scan(&value); errS != nil {
+			log.Printf("[queryStrings] rows.Scan err: %v", errS)
+			continue
+		}
+		values = append(values, value)
+	}
+
+	return values
+}
+
+// mysqlGrants 库级, 表级和列级权限涉及的账号及其在本库上的权限, 全局权限账号 (如 root) 和全局权限不导出
+func mysqlGrants(workArgs workArgsT) []string {
+	grantees := queryStrings(workArgs, `SELECT GRANTEE FROM information_schema.SCHEMA_PRIVILEGES WHERE TABLE_SCHEMA = DATABASE()
+UNION SELECT GRANTEE FROM information_schema.TABLE_PRIVILEGES WHERE TABLE_SCHEMA = DATABASE()
+UNION SELECT GRANTEE FROM information_schema.COLUMN_PRIVILEGES WHERE TABLE_SCHEMA = DATABASE()
+ORDER BY 1`)
+
+	var database string
+	if err := workArgs.DB.QueryRow("SELECT DATABASE()").Scan(&database); err != nil {
+		panic(err)
+	}
+	localTarget := "`" + database + "`."
+
+	var statements []string
+	for _, grantee := range grantees {
+		var createSQL string
+		err := workArgs.DB.QueryRow("SHOW CREATE USER " + grantee).Scan(&createSQL)
+		if err != nil {
+			log.Printf("[mysqlGrants] show create user %s err: %v", grantee, err)
+		} else {
+			createSQL = strings.Replace(createSQL, "CREATE USER ", "CREATE USER IF NOT EXISTS ", 1)
+			if workArgs.StripPassword {
+				createSQL = grantPasswordRe.ReplaceAllString(createSQL, "")
+			}
+			statements = append(statements, createSQL)
+		}
+
+		for _, grant := range queryStrings(workArgs, "SHOW GRANTS FOR "+grantee) {
+			// 全局权限 (ON *.*) 不属于本库, 与其他库上的权限一样不导出
+			if m := grantTargetRe.FindStringSubmatch(grant); m != nil && !strings.HasPrefix(m[1], localTarget) {
+				continue
+			}
+			statements = append(statements, rewriteDatabase(workArgs, grant))
+		}
+	}
+
+	return statements
+}
+
+// postgresGrants 当前 schema 中表权限涉及的角色, 按表合并权限
+func postgresGrants(workArgs workArgsT) []string {
+	querySQL := `SELECT grantee, table_name, string_agg(privilege_type, ', ' ORDER BY privilege_type)
+FROM information_schema.table_privileges
+WHERE table_schema = current_schema() AND grantee NOT IN ('PUBLIC', current_user)
+GROUP BY grantee, table_name ORDER BY grantee, table_name`
+	log.Printf("[postgresGrants] sql: %s", querySQL)
+
+	rows, err := workArgs.DB.Query(querySQL)
+	if err != nil {
+		panic(err)
+	}
+
+	grants := make(map[string][]string)
+	for rows.Next() {
+		var grantee, table, privileges string
+		if errS := rows.Scan(&grantee, &table, &privileges); errS != nil {
+			log.Printf("[postgresGrants] rows.Scan err: %v", errS)
+			continue
+		}
+		grants[grantee] = append(grants[grantee], fmt.Sprintf("GRANT %s ON %s TO %s", privileges, quoteTable(workArgs, table), quoteIdent(workArgs, grantee)))
+	}
+	_ = rows.Close()
+
+	var roles []string
+	for role := range grants {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	var statements []string
+	for _, role := range roles {
+		var canLogin bool
+		var password sql.NullString
+		err = workArgs.DB.QueryRow("SELECT rolcanlogin FROM pg_roles WHERE rolname = $1", role).Scan(&canLogin)
+		if err != nil {
+			log.Printf("[postgresGrants] read role %s err: %v", role, err)
+		}
+
+		createSQL := "CREATE ROLE " + quoteIdent(workArgs, role)
+		if canLogin {
+			createSQL += " LOGIN"
+		}
+		if !workArgs.StripPassword {
+			// 读取密码哈希需要超级用户权限
+			if errP := workArgs.DB.QueryRow("SELECT rolpassword FROM pg_authid WHERE rolname = $1", role).Scan(&password); errP != nil {
+				log.Printf("[postgresGrants] can not read password of %s, err: %v", role, errP)
+			} else if password.Valid {
+				createSQL += fmt.Sprintf(" PASSWORD '%s'", workArgs.EscapeFunc(password.String))
+			}
+		}
+
+		// postgres 没有 CREATE ROLE IF NOT EXISTS, 角色已存在时跳过, 重复导入不会失败
+		statements = append(statements, fmt.Sprintf("DO $do$\nBEGIN\n  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = '%s') THEN\n    %s;\n  END IF;\nEND\n$do$",
+			workArgs.EscapeFunc(role), createSQL))
+		statements = append(statements, grants[role]...)
+	}
+
+	return statements
+}
@@ -0,0 +1,34 @@
+package main
+
+import "strings"
+
+// quoteIdent 按数据库类型给单个标识符(列名, 索引名, 库名等)整体加引号, mysql 用反引号, postgres 用双引号, 名字中的引号写两次;
+// 名字中的 . 是标识符的一部分, 如列名 a.b 写为 `a.b`.
+func quoteIdent(workArgs workArgsT, name string) string {
+	quote := "`"
+	if workArgs.DbType == "postgres" {
+		quote = `"`
+	}
+
+	return quote + strings.Replace(name, quote, quote+quote, -1) + quote
+}
+
+// quoteTable 给表名加引号, 带 schema 的名称如 information_schema.processlist 分别加引号
+func quoteTable(workArgs workArgsT, name string) string {
+	parts := strings.Split(name, ".")
+	for k, part := range parts {
+		parts[k] = quoteIdent(workArgs, part)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// quoteIdents 给一组名字加引号, 以逗号分隔
+func quoteIdents(workArgs workArgsT, names []string) string {
+	quoted := make([]string, len(names))
+	for k, name := range names {
+		quoted[k] = quoteIdent(workArgs, name)
+	}
+
+	return strings.Join(quoted, ", ")
+}
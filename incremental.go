@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// watermark 记录 -incremental-column 导出过的最大值
+type watermark struct {
+	mu    sync.Mutex
+	value string
+	valid bool
+}
+
+func (w *watermark) Update(value string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.valid || compareValues(value, w.value) > 0 {
+		w.value = value
+		w.valid = true
+	}
+}
+
+func (w *watermark) Value() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.value, w.valid
+}
+
+// compareValues 两个值都是数字时按数字比较, 否则按字符串比较(适用于 YYYY-MM-DD HH:MM:SS 格式的时间)
+func compareValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// loadIncrementalState 读取增量导出状态文件, 内容为 {"表名": "上次导出的最大值"}, 文件不存在时返回空
+func loadIncrementalState(filename string) (map[string]string, error) {
+	state := make(map[string]string)
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// stateFileMu 分表并发导出时各 worker 依次读写状态文件, 不会互相覆盖水位
+var stateFileMu sync.Mutex
+
+// saveIncrementalState 更新状态文件中某个表的最大值, 先写临时文件再改名, 避免中断时损坏状态
+func saveIncrementalState(filename string, table string, value string) error {
+	stateFileMu.Lock()
+	defer stateFileMu.Unlock()
+
+	state, err := loadIncrementalState(filename)
+	if err != nil {
+		return err
+	}
+	state[table] = value
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
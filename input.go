@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// readInputSQL 读取 -input/-table-query 中的查询: 去掉 UTF-8 BOM, 把 UTF-16 转为 UTF-8,
+// 跳过 psql 的 \ 命令和 mysql 客户端的 DELIMITER 指令, 去掉结尾的分隔符; 文件中只能有一条语句.
+func readInputSQL(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	text, err := decodeInputText(data)
+	if err != nil {
+		return "", err
+	}
+
+	delimiter := ";"
+	var lines []string
+	for k, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, `\`) {
+			log.Printf("[readInputSQL] %s:%d skip psql command: %s", filename, k+1, trimmed)
+			continue
+		}
+		if fields := strings.Fields(trimmed); len(fields) > 0 && strings.EqualFold(fields[0], "DELIMITER") {
+			if len(fields) != 2 {
+				return "", fmt.Errorf("line %d: invalid DELIMITER directive: %s", k+1, trimmed)
+			}
+			delimiter = fields[1]
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, "\r"))
+	}
+
+	query := strings.TrimSpace(strings.Join(lines, "\n"))
+	for strings.HasSuffix(query, delimiter) || strings.HasSuffix(query, ";") {
+		query = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(query, delimiter), ";"))
+	}
+	if len(query) == 0 {
+		return "", errors.New("no query found")
+	}
+	if statementCount(query, delimiter) > 1 {
+		return "", errors.New("more than one statement, the input must be a single query")
+	}
+
+	return query, nil
+}
+
+// decodeInputText 按 BOM 识别编码, 没有 BOM 且前两个字节中有 NUL 时按 UTF-16LE/BE 处理
+func decodeInputText(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], false)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], true)
+	case len(data) >= 2 && data[0] != 0 && data[1] == 0:
+		return decodeUTF16(data, false)
+	case len(data) >= 2 && data[0] == 0 && data[1] != 0:
+		return decodeUTF16(data, true)
+	}
+
+	if !utf8.Valid(data) {
+		return "", errors.New("input is not valid UTF-8 or UTF-16 text")
+	}
+
+	return string(data), nil
+}
+
+func decodeUTF16(data []byte, bigEndian bool) (string, error) {
+	if len(data)%2 != 0 {
+		return "", errors.New("input is not valid UTF-16 text, odd number of bytes")
+	}
+
+	units := make([]uint16, len(data)/2)
+	for k := range units {
+		if bigEndian {
+			units[k] = uint16(data[2*k])<<8 | uint16(data[2*k+1])
+		} else {
+			units[k] = uint16(data[2*k+1])<<8 | uint16(data[2*k])
+		}
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// statementCount 统计以分隔符分开的语句数, 跳过引号和注释中的分隔符
+func statementCount(query string, delimiter string) int {
+	count := 1
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], delimiter) || c == ';':
+			count++
+		}
+	}
+
+	return count
+}
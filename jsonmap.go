@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// doWorkExportJSONMap -format=json-map: 输出一个 JSON 对象, 每张表一个键, 表内按主键值索引各行;
+// 表名, 主键值和列名都按字典序输出, 便于对比两次导出. 联合主键的键为各主键值组成的 JSON 数组文本.
+// 整表读入内存, 只适合配置表这类小表.
+func doWorkExportJSONMap(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkExportJSONMap] start work")
+
+	tables := make(map[string]map[string]map[string]json.RawMessage)
+	for _, tbl := range fetchTables(workArgs) {
+		taskArgs := withTaskLogger(workArgs, tbl, 0)
+		taskArgs.Table = tbl
+		if taskArgs.Limit > 0 || len(taskArgs.Sample) > 0 {
+			taskArgs.Sampler, _ = newRowSampler(taskArgs.Limit, taskArgs.Sample)
+		}
+
+		pk := detectPrimaryKey(taskArgs, tbl)
+		if len(pk) == 0 {
+			taskArgs.Logger.Printf("[doWorkExportJSONMap] no primary key, skip table")
+			workArgs.Summary.Warn()
+			continue
+		}
+
+		rows := make(map[string]map[string]json.RawMessage)
+		forEachDataRow(taskArgs, func(cols []bundleColumn, vals []interface{}) {
+			row := make(map[string]json.RawMessage, len(cols))
+			keys := make(map[string]string, len(pk))
+			for k, col := range cols {
+				row[col.Name] = json.RawMessage(bigqueryValue(taskArgs, vals[k], col.DbType))
+				if tools.InArray(col.Name, pk) && vals[k] != nil {
+					keys[col.Name] = renderValue(taskArgs, vals[k], col.DbType)
+				}
+			}
+			if len(keys) != len(pk) {
+				taskArgs.Logger.Printf("[doWorkExportJSONMap] primary key is not selected or null, skip row")
+				workArgs.Summary.Warn()
+				return
+			}
+
+			key := keys[pk[0]]
+			if len(pk) > 1 {
+				var parts []string
+				for _, name := range pk {
+					parts = append(parts, keys[name])
+				}
+				text, _ := json.Marshal(parts)
+				key = string(text)
+			}
+			rows[key] = row
+		})
+		tables[tbl] = rows
+	}
+
+	// encoding/json 按键的字典序输出 map
+	data, err := json.MarshalIndent(tables, "", "  ")
+	if err != nil {
+		log.Printf("[doWorkExportJSONMap] json encode err: %v", err)
+		os.Exit(20)
+	}
+	if _, err = output.Write(append(data, '\n')); err != nil {
+		log.Printf("[doWorkExportJSONMap] write err: %v", err)
+		os.Exit(20)
+	}
+
+	log.Printf("[doWorkExportJSONMap] jobs have done.")
+}
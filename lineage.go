@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+type lineageNode struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type lineageEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type lineageGraph struct {
+	Nodes []lineageNode `json:"nodes"`
+	Edges []lineageEdge `json:"edges"`
+}
+
+// lineageRefRe 匹配定义中被引用的表, 支持 db.table 形式的跨库引用
+var lineageRefRe = regexp.MustCompile("(?i)\\b(?:FROM|JOIN|UPDATE|INTO)\\s+((?:`[^`]+`|\"[^\"]+\"|[\\w$]+)(?:\\.(?:`[^`]+`|\"[^\"]+\"|[\\w$]+))?)")
+
+// lineageNextRefRe 匹配 FROM a, b 中逗号之后的表, lineageAliasRe 匹配表之后的别名
+var lineageNextRefRe = regexp.MustCompile("^\\s*,\\s*((?:`[^`]+`|\"[^\"]+\"|[\\w$]+)(?:\\.(?:`[^`]+`|\"[^\"]+\"|[\\w$]+))?)")
+var lineageAliasRe = regexp.MustCompile("(?i)^\\s*(AS\\s+)?(`[^`]+`|\"[^\"]+\"|[\\w$]+)")
+
+// lineageClauseWords 可以紧跟在 FROM 的表之后的关键字, 不是别名
+var lineageClauseWords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true, "NATURAL": true,
+	"STRAIGHT_JOIN": true, "ON": true, "USING": true, "GROUP": true, "ORDER": true, "HAVING": true, "LIMIT": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "WINDOW": true, "FOR": true, "SET": true, "VALUES": true, "SELECT": true,
+}
+
+// lineageRefs 返回定义中引用的表, 包括 FROM a, b 逗号连接的表
+func lineageRefs(definition string) []string {
+	var refs []string
+	for _, m := range lineageRefRe.FindAllStringSubmatchIndex(definition, -1) {
+		refs = append(refs, definition[m[2]:m[3]])
+		if !strings.EqualFold(definition[m[0]:m[0]+4], "FROM") {
+			continue
+		}
+
+		rest := definition[m[1]:]
+		for {
+			if a := lineageAliasRe.FindStringSubmatch(rest); a != nil && (len(a[1]) > 0 || !lineageClauseWords[strings.ToUpper(a[2])]) {
+				rest = rest[len(a[0]):]
+			}
+			next := lineageNextRefRe.FindStringSubmatchIndex(rest)
+			if next == nil {
+				break
+			}
+			refs = append(refs, rest[next[2]:next[3]])
+			rest = rest[next[1]:]
+		}
+	}
+
+	return refs
+}
+
+func doWorkLineage(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkLineage] start work")
+
+	schemaExpr := "DATABASE()"
+	if workArgs.DbType == "postgres" {
+		schemaExpr = "current_schema()"
+	}
+
+	var localSchema string
+	err := workArgs.DB.QueryRow(fmt.Sprintf("SELECT %s", schemaExpr)).Scan(&localSchema)
+	if err != nil {
+		panic(err)
+	}
+
+	definitions := make(map[string]string)
+	nodeTypes := make(map[string]string)
+
+	tableSQL := fmt.Sprintf("SELECT table_name FROM information_schema.tables WHERE table_schema = %s", schemaExpr)
+	log.Printf("[doWorkLineage] sql: %s", tableSQL)
+	rows, err := workArgs.DB.Query(tableSQL)
+	if err != nil {
+		panic(err)
+	}
+	for rows.Next() {
+		var name string
+		if errS := rows.Scan(&name); errS != nil {
+			log.Printf("[doWorkLineage] rows.Scan err: %v", errS)
+			continue
+		}
+		nodeTypes[name] = "table"
+	}
+	_ = rows.Close()
+
+	viewSQL := fmt.Sprintf("SELECT table_name, view_definition FROM information_schema.views WHERE table_schema = %s", schemaExpr)
+	routineSQL := fmt.Sprintf("SELECT routine_name, routine_type, routine_definition FROM information_schema.routines WHERE routine_schema = %s", schemaExpr)
+
+	for _, querySQL := range []string{viewSQL, routineSQL} {
+		log.Printf("[doWorkLineage] sql: %s", querySQL)
+
+		rows, err := workArgs.DB.Query(querySQL)
+		if err != nil {
+			panic(err)
+		}
+
+		for rows.Next() {
+			var name, objType, definition string
+			var def interface{}
+			if querySQL == viewSQL {
+				objType = "VIEW"
+				err = rows.Scan(&name, &def)
+			} else {
+				err = rows.Scan(&name, &objType, &def)
+			}
+			if err != nil {
+				log.Printf("[doWorkLineage] rows.Scan err: %v", err)
+				continue
+			}
+			if def != nil {
+				definition = fmt.Sprintf("%s", def)
+			}
+
+			definitions[name] = definition
+			nodeTypes[name] = strings.ToLower(objType)
+		}
+		_ = rows.Close()
+	}
+
+	graph := buildLineageGraph(definitions, nodeTypes, localSchema)
+
+	if workArgs.LineageFormat == "dot" {
+		_, _ = output.WriteString("digraph lineage {\n")
+		for _, node := range graph.Nodes {
+			shape := "box"
+			if node.Type != "table" {
+				shape = "ellipse"
+			}
+			_, _ = output.WriteString(fmt.Sprintf("  %q [shape=%s];\n", node.Name, shape))
+		}
+		for _, edge := range graph.Edges {
+			_, _ = output.WriteString(fmt.Sprintf("  %q -> %q;\n", edge.From, edge.To))
+		}
+		_, _ = output.WriteString("}\n")
+	} else {
+		data, err := json.MarshalIndent(graph, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		_, _ = output.Write(data)
+		_, _ = output.WriteString("\n")
+	}
+
+	log.Printf("[doWorkLineage] jobs have done.")
+}
+
+// buildLineageGraph 解析视图和存储过程的定义, 生成 被引用对象 -> 视图/存储过程 的依赖图.
+// nodeTypes 为当前库中已知的对象, 未限定库名且不在其中的引用(如存储过程变量)会被忽略.
+func buildLineageGraph(definitions map[string]string, nodeTypes map[string]string, localSchema string) lineageGraph {
+	var graph lineageGraph
+
+	types := make(map[string]string)
+
+	var names []string
+	for name := range definitions {
+		names = append(names, name)
+		types[name] = nodeTypes[name]
+	}
+	sort.Strings(names)
+
+	seen := make(map[lineageEdge]bool)
+	for _, name := range names {
+		for _, ref := range lineageRefs(definitions[name]) {
+			ref = strings.NewReplacer("`", "", `"`, "").Replace(ref)
+			ref = strings.TrimPrefix(ref, localSchema+".")
+			if ref == name {
+				continue
+			}
+			if !strings.Contains(ref, ".") {
+				if _, ok := nodeTypes[ref]; !ok {
+					continue
+				}
+			}
+
+			edge := lineageEdge{From: ref, To: name}
+			if seen[edge] {
+				continue
+			}
+			seen[edge] = true
+			graph.Edges = append(graph.Edges, edge)
+
+			if objType, ok := nodeTypes[ref]; ok {
+				types[ref] = objType
+			} else {
+				types[ref] = "table"
+			}
+		}
+	}
+
+	for name, objType := range types {
+		graph.Nodes = append(graph.Nodes, lineageNode{Name: name, Type: objType})
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].Name < graph.Nodes[j].Name
+	})
+
+	return graph
+}
+
+// columnLineage -column-lineage 时返回 INSERT 中每列的来源, 用作列名后的注释; 只在使用了自定义查询, 回填列,
+// 来源标记列或历史版本列时返回, 直接导出整表时每列都来自同名列, 不需要注释.
+func columnLineage(workArgs workArgsT, querySQL string, fields []string, backfill []string) []string {
+	query, custom := workArgs.TableSQL[workArgs.Table]
+	if !custom && !workArgs.Chunk {
+		query, custom = querySQL, true
+	}
+	if !workArgs.ColumnLineage || (!custom && len(backfill) == 0 && len(workArgs.SourceTagColumn) == 0 && !workArgs.History) {
+		return nil
+	}
+
+	var exprs map[string]string
+	if custom {
+		exprs = tools.SelectExpressions(query)
+	}
+
+	sources := make([]string, len(fields))
+	for k, field := range fields {
+		switch {
+		case len(workArgs.SourceTagColumn) > 0 && k == len(fields)-1:
+			sources[k] = fmt.Sprintf("source tag '%s'", workArgs.SourceTag)
+		case tools.InArray(field, backfill):
+			sources[k] = "backfill " + backfillValue(workArgs, field)
+		case workArgs.History && (field == "row_start" || field == "row_end"):
+			sources[k] = strings.ToUpper(field) + " (system versioning)"
+		case custom && len(exprs[field]) > 0:
+			sources[k] = exprs[field]
+		case custom:
+			sources[k] = "query column " + field
+		default:
+			sources[k] = workArgs.Table + "." + field
+		}
+		// 注释只能占一行
+		sources[k] = strings.Join(strings.Fields(sources[k]), " ")
+	}
+
+	return sources
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lint 问题级别
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+	lintNotice  = "notice"
+)
+
+type lintIssue struct {
+	Level   string
+	Table   string
+	Message string
+}
+
+var (
+	lintColumnRe     = regexp.MustCompile("^`([^`]+)`\\s+(.+?),?$")
+	lintVarcharRe    = regexp.MustCompile(`(?i)^varchar\((\d+)\)`)
+	lintBoolRe       = regexp.MustCompile(`(?i)^(tinyint\(1\)|bool|boolean)(\s|$)`)
+	lintIndexRe      = regexp.MustCompile(`(?i)^(PRIMARY KEY|UNIQUE KEY|UNIQUE INDEX|KEY|INDEX)\b[^(]*\((.+)\)`)
+	lintForeignKeyRe = regexp.MustCompile(`(?i)FOREIGN KEY\s*\(([^)]+)\)`)
+	lintIdentRe      = regexp.MustCompile("`([^`]+)`")
+)
+
+func doWorkLint(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkLint] start work")
+
+	var issues []lintIssue
+	for _, tbl := range fetchTables(workArgs) {
+		createSQL := showCreateTable(workArgs, tbl)
+		issues = append(issues, lintCreateTable(tbl, createSQL, workArgs.LintVarcharMax)...)
+	}
+
+	var errCount int
+	for _, issue := range issues {
+		if issue.Level == lintError {
+			errCount++
+		}
+		_, _ = output.WriteString(fmt.Sprintf("[%s] %s: %s\n", issue.Level, issue.Table, issue.Message))
+	}
+	_, _ = output.WriteString(fmt.Sprintf("\n/* lint: %d issues, %d errors */\n", len(issues), errCount))
+
+	log.Printf("[doWorkLint] jobs have done.")
+
+	if errCount > 0 {
+		_ = output.Close()
+		os.Exit(40)
+	}
+}
+
+// lintCreateTable 根据 SHOW CREATE TABLE 的输出检查表结构中的常见问题
+func lintCreateTable(tbl string, createSQL string, varcharMax int) []lintIssue {
+	var issues []lintIssue
+	var hasPrimary bool
+	var indexes [][]string
+	var foreignKeys [][]string
+
+	for _, line := range strings.Split(createSQL, "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := lintColumnRe.FindStringSubmatch(line); m != nil {
+			col, def := m[1], m[2]
+			nullable := !strings.Contains(strings.ToUpper(def), "NOT NULL")
+
+			if vm := lintVarcharRe.FindStringSubmatch(def); vm != nil {
+				width, _ := strconv.Atoi(vm[1])
+				if varcharMax > 0 && width > varcharMax {
+					issues = append(issues, lintIssue{lintNotice, tbl, fmt.Sprintf("column `%s` is varchar(%d), wider than %d", col, width, varcharMax)})
+				}
+			}
+			if lintBoolRe.MatchString(def) && nullable {
+				issues = append(issues, lintIssue{lintWarning, tbl, fmt.Sprintf("boolean column `%s` is nullable", col)})
+			}
+			continue
+		}
+
+		if m := lintIndexRe.FindStringSubmatch(line); m != nil {
+			if strings.EqualFold(m[1], "PRIMARY KEY") {
+				hasPrimary = true
+			}
+			indexes = append(indexes, lintIdents(m[2]))
+			continue
+		}
+
+		if m := lintForeignKeyRe.FindStringSubmatch(line); m != nil {
+			foreignKeys = append(foreignKeys, lintIdents(m[1]))
+		}
+	}
+
+	if !hasPrimary {
+		issues = append(issues, lintIssue{lintError, tbl, "missing primary key"})
+	}
+
+	for _, fk := range foreignKeys {
+		if !lintHasIndexPrefix(indexes, fk) {
+			issues = append(issues, lintIssue{lintWarning, tbl, fmt.Sprintf("foreign key (`%s`) has no index", strings.Join(fk, "`, `"))})
+		}
+	}
+
+	return issues
+}
+
+func lintIdents(list string) []string {
+	var idents []string
+	for _, m := range lintIdentRe.FindAllStringSubmatch(list, -1) {
+		idents = append(idents, m[1])
+	}
+
+	return idents
+}
+
+// lintHasIndexPrefix 外键列需要是某个索引的最左前缀
+func lintHasIndexPrefix(indexes [][]string, cols []string) bool {
+	for _, idx := range indexes {
+		if len(idx) < len(cols) {
+			continue
+		}
+
+		match := true
+		for i, col := range cols {
+			if idx[i] != col {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"hash/crc32"
+	"io"
 	"log"
 	"math"
 	"os"
+	"path"
 	"reflect"
 	"regexp"
 	"strings"
@@ -25,40 +28,348 @@ type workArgsT struct {
 	DbHost     string
 	DbUser     string
 	DbPassword string
+	DbPwdFile  string
+	AskPass    bool
 	DbCharset  string
+	DbSocket   string // unix socket, mysql 为 socket 文件, postgres 为 socket 所在目录
+	DbSchema   string // postgres 导出的 schema, 逗号分隔, 同时作为 search_path
+	DSN        string // 完整的驱动DSN, 设置后忽略 db-host,db-user,db-password,db-name,db-charset
+	DbSSLMode  string
+	DbSSLCa    string
+	DbSSLCert  string
+	DbSSLKey   string
 
-	DB *sql.DB
+	DB sqlQueryer // 连接池, -source-position 时为持有快照事务的专用连接
 
-	EscapeFunc func(string) string
+	Record string // 把查询和结果录制到该文件
+	Replay string // 不连接数据库, 从录制文件回放查询结果
+
+	Escape          string              // 输出中字符串的转义方式
+	EscapeFunc      func(string) string // 转义输出中的字符串
+	QueryEscapeFunc func(string) string // 转义源库查询条件中的字符串, 按源库类型选择, 与 -escape 无关
+
+	Logger *log.Logger // 日志, 按表导出时带 [表名#worker] 前缀
 
 	Model     string // 导出模式
+	Preset    string // 内置的参数组合
+	Format    string // 输出格式
 	Table     string
+	Where     string // 追加到分块查询的过滤条件
 	Chunk     bool
 	Input     string
 	Output    string
 	SkipField string
+	OnlyField string // 只导出这些列
 	Help      bool
+
+	ExcludeTable string // -table=all 时跳过的表, 支持 glob
+	Priority     string // 优先导出的表, 支持 glob, 按顺序排在前面
+	TableRegex   string // 按正则选择表
+	TableRegexp  *regexp.Regexp
+
+	ChangedSince  string // 只导出该时间之后有更新的表
+	ChunkChecksum bool   // 分块前输出行数和 crc32 注释
+
+	ChunkAnomalyFactor  float64     // 分块耗时超过中位数的倍数时告警
+	ChunkAnomalyWebhook string      // 慢分块告警的通知地址
+	ChunkTimer          *chunkTimer // 单表的分块耗时
+
+	OrderBy      orderByFlag // 按表指定数据导出的排序列
+	ClusterOrder bool        // 按目标表主键顺序导出
+
+	ColumnGroupSize int // 列数超过该值的表按列切片导出
+
+	AsOf            string // 导出该时间点的表数据
+	ValidityColumns string // 应用历史表的有效期列, from,to; 为空时按 mariadb 系统版本表处理
+	History         bool   // 导出 mariadb 系统版本表的全部历史版本到 <table>_history
+
+	TableQuery kvFlag            // 按表指定代替 SELECT * 的查询文件, table=file
+	TableSQL   map[string]string // 已读取的自定义查询
+
+	ColumnLineage bool // INSERT 的列名后用注释标明每列的来源
+
+	Distinct     bool
+	DedupeOn     string
+	DedupeMaxKey int
+	Dedupe       *dedupeSet // 按 -dedupe-on 列在客户端去重
+
+	StripPassword bool // grants 模式中去掉密码哈希
+
+	StripDefiner   bool   // 去掉视图, 触发器, 存储过程和事件的 DEFINER
+	RewriteDefiner string // 把 DEFINER 替换为该账号, user@host
+
+	RewriteCharset   string            // 建表语句中替换的字符集, from:to,...
+	RewriteCollation string            // 建表语句中替换的排序规则, from:to,...
+	CharsetMap       map[string]string // 已解析的 -rewrite-charset
+	CollationMap     map[string]string // 已解析的 -rewrite-collation
+	RewriteEngine    string            // 建表语句中替换的存储引擎, from:to,...
+	EngineMap        map[string]string // 已解析的 -rewrite-engine
+
+	KeepAutoIncrement bool // 建表语句保留 AUTO_INCREMENT 计数
+	IfNotExists       bool // 用 CREATE TABLE IF NOT EXISTS 代替 DROP TABLE
+	AddCreateDatabase bool // 导出文件开头写出 CREATE DATABASE 和 USE
+	DisableChecks     bool // 导出文件首尾关闭并恢复外键和唯一性检查
+
+	TargetDB       string // 输出中替换的库名, 用于 CREATE DATABASE/USE 和带库名的标识符
+	SourceDatabase string // 源库名, 设置 -target-db 时读取
+
+	SessionCharset  string // 导入会话的字符集, SET NAMES
+	SessionSQLMode  string // 导入会话的 sql_mode, - 表示不设置
+	SessionTimeZone string // 导出和导入会话的时区
+
+	MydumperDir      string // 按 mydumper 目录结构导出到该目录
+	MydumperFileSize int64  // 单个数据文件的大小上限, MB
+
+	Bundle         string // 数据仓库装载包: bigquery, snowflake, redshift
+	BundleDir      string
+	BundleDataset  string // 装载脚本中的目标 dataset, 默认为库名
+	BundleS3Prefix string // redshift 装载包上传的 S3 路径
+
+	Summary *dumpSummary // 导出文件末尾汇总的行数和告警数
+
+	PrimeScript string // 导入后预热缓存的脚本
+
+	JSONCast bool // JSON 列写出 CAST(... AS JSON) / ::jsonb
+
+	MaxTotalRows  int64 // 本次导出的总行数上限
+	MaxTotalBytes int64 // 本次导出的数据字节数上限
+	Force         bool  // 超过上限时继续导出
+
+	ColumnStats bool        // 装载包中附带每列的 min/max/null 统计
+	Stats       *tableStats // 单张表的统计
+
+	Chaos *chaosT // 故障注入
+
+	InsertMode string // 数据语句: insert, insert-ignore, replace
+
+	RowsPerInsert     int // 每条 INSERT 最多的行数, 0 表示整个分块一条
+	ExtendedInsert    bool
+	MaxStatementBytes int // 每条 INSERT 的字节数上限
+
+	TruncateBeforeInsert bool // 表数据之前写出 TRUNCATE TABLE
+	DeleteBeforeInsert   bool // 表数据之前写出 DELETE FROM ... WHERE
+	SkipClear            bool // 分表和多分片合并时只在第一张表之前清空
+
+	Shards      kvFlag // 把分表作为一张逻辑表导出, logical=glob
+	TargetTable string // INSERT 的目标表, 为空时使用 Table
+
+	RenameTable  string            // 输出语句中的表名替换, old:new,...
+	TableRenames map[string]string // 已解析的 -rename-table
+	TablePrefix  string            // 输出语句中的表名前缀
+
+	Sources         kvFlag     // 表结构相同的多个分片连接, tag=dsn
+	SourceDBs       []sourceDB // 已连接的分片
+	SourceTag       string     // 当前导出的分片标签
+	SourceTagColumn string     // 写入分片标签的列
+
+	OutfileDir      string // mysql 服务器上 SELECT INTO OUTFILE 的目录
+	OutfileLocalDir string // 该目录在本机的挂载路径
+
+	Limit   int64       // 每张表最多导出的行数
+	Sample  string      // 按比例或每 N 行抽样导出
+	Sampler *rowSampler // 单张表的抽样状态
+
+	Parallel int // 单表按主键区间并发导出的 worker 数
+
+	MaxRowsPerSecond  int64        // 读取源库的总行数速率上限
+	MaxBytesPerSecond int64        // 读取源库的总字节数速率上限
+	Throttle          *rateLimiter // 所有 worker 共用的限速
+
+	Mask     kvFlag      // 列的脱敏规则, [table.]col=rule
+	MaskFile string      // 脱敏规则文件, 每行一条 [table.]col=rule
+	Masker   *dataMasker // 已解析的脱敏规则, 所有 worker 共用
+
+	SourcePosition bool // 记录导出开始时的 binlog/GTID/WAL 位置
+
+	TargetType string // transform 模式生成 INSERT 的方言
+
+	DateFormat      string // DATE 列的输出格式, Go 时间格式
+	TimestampFormat string // DATETIME/TIMESTAMP 列的输出格式, Go 时间格式
+
+	ValidateUTF8 bool // 检查文本列中的非法 UTF-8 字节序列
+	FixUTF8      bool // 把非法字节序列替换为 U+FFFD
+
+	MaxDuration    time.Duration // 超过该时长后在分块边界停止
+	Deadline       time.Time
+	CheckpointFile string       // 停止时保存断点, 下次从断点继续
+	Checkpoint     *checkpointT // 本次导出要继续的断点
+
+	LineEnding string // csv/jsonl 的换行符
+	BOM        bool   // 输出文件开头写入 UTF-8 BOM
+
+	IncrementalColumn string     // 增量导出的水位列
+	Since             string     // 只导出水位列大于该值的行
+	StateFile         string     // 保存每个表水位的状态文件
+	Watermark         *watermark // 本次导出的最大水位
+	Upsert            bool       // 生成 upsert 语句, -incremental-column 时自动开启
+	PrimaryKey        []string
+
+	TargetDSN     string
+	TargetDDL     string
+	Backfill      kvFlag   // 目标表新增列的取值
+	TargetColumns []string // 目标表的列, 源表缺少的列在 INSERT 中补齐
+
+	LintVarcharMax int    // lint 模式下 varchar 宽度上限
+	LineageFormat  string // lineage 模式输出格式
 }
 
 const programName = "db-export-tool"
 
-var workArgs workArgsT
+// chunkSize 分块导出时每块的行数
+const chunkSize int64 = 1000
+
+// chunkResult 单个分块的导出结果
+type chunkResult struct {
+	Rows    int64    // 写出的行数
+	Scanned int64    // 查询返回的行数, 去重时可能多于 Rows
+	LastKey []string // 分页键各列最后一行的值
+	Err     error    // 分块查询或写出失败, 由调用方保存断点后退出
+	ErrCode int      // Err 对应的退出码
+}
+
+var workArgs = workArgsT{
+	OrderBy:    orderByFlag{},
+	Backfill:   kvFlag{},
+	Sources:    kvFlag{},
+	TableQuery: kvFlag{},
+	Shards:     kvFlag{},
+	Mask:       kvFlag{},
+	Chaos:      &chaosT{},
+}
 
 func init() {
 	flag.StringVar(&workArgs.DbType, "db-type", "mysql", "set db type, support:mysql,postgres")
 	flag.StringVar(&workArgs.Database, "db-name", "", "database")
 	flag.StringVar(&workArgs.DbHost, "db-host", "127.0.0.1:3306", "set database host")
 	flag.StringVar(&workArgs.DbUser, "db-user", "", "database user")
-	flag.StringVar(&workArgs.DbPassword, "db-pwd", "", "database password")
+	flag.StringVar(&workArgs.DbPassword, "db-password", "", "database password")
+	flag.StringVar(&workArgs.DbPwdFile, "db-password-file", "", "read database password from the first line of file")
+	flag.BoolVar(&workArgs.AskPass, "ask-pass", false, "prompt for database password on terminal")
 	flag.StringVar(&workArgs.DbCharset, "db-charset", "utf8", "charset")
-
-	flag.StringVar(&workArgs.Model, "model", "schema", "set export model, support:schema,data")
-	flag.StringVar(&workArgs.Table, "table", "", "databases tables")
+	flag.StringVar(&workArgs.DbSchema, "db-schema", "", "postgres only: export tables of these schemas, e.g. public,reporting; also set as search_path, table names are qualified when more than one schema is given")
+	flag.StringVar(&workArgs.DbSocket, "db-socket", "", "unix socket: mysql socket file or postgres socket directory, db-host starting with / is used as socket too")
+	flag.StringVar(&workArgs.DbSSLMode, "db-ssl-mode", "", "set ssl mode, support:disable,prefer,require,verify-ca,verify-full")
+	flag.StringVar(&workArgs.DbSSLCa, "db-ssl-ca", "", "ssl ca certificate file, with ssl mode require or unset the server certificate is verified against it as in verify-ca")
+	flag.StringVar(&workArgs.DbSSLCert, "db-ssl-cert", "", "ssl client certificate file")
+	flag.StringVar(&workArgs.DbSSLKey, "db-ssl-key", "", "ssl client key file")
+	flag.StringVar(&workArgs.Record, "record", "", "record every query and its result to a json fixture file, for regression tests")
+	flag.StringVar(&workArgs.Replay, "replay", "", "serve queries from a fixture file written by -record instead of connecting to the database")
+	flag.StringVar(&workArgs.DSN, "dsn", "", "full driver dsn, overrides db-host,db-user,db-password,db-name,db-charset,db-ssl-*; mysql can reference db-ssl-* certs with tls=custom")
+
+	flag.StringVar(&workArgs.Preset, "preset", "", "apply a built-in set of flags, flags set on the command line take precedence, support:"+strings.Join(presetNames(), ","))
+	flag.StringVar(&workArgs.Model, "model", "schema", "set export model, support:schema,data,all,lint,validate,lineage,grants,from-dump,transform")
+	flag.StringVar(&workArgs.DateFormat, "date-format", mysqlDateLayout, "output layout of DATE columns, Go time layout")
+	flag.StringVar(&workArgs.TimestampFormat, "timestamp-format", mysqlDatetimeLayout, "output layout of DATETIME/TIMESTAMP columns, Go time layout")
+	flag.BoolVar(&workArgs.ValidateUTF8, "validate-utf8", false, "log table, pk and column of text values with invalid utf8 byte sequences")
+	flag.BoolVar(&workArgs.FixUTF8, "fix-utf8", false, "with validate-utf8, replace invalid utf8 byte sequences with U+FFFD")
+	flag.DurationVar(&workArgs.MaxDuration, "max-duration", 0, "stop data export at the next chunk boundary after this duration, e.g. 4h, exit code 75")
+	flag.StringVar(&workArgs.CheckpointFile, "checkpoint-file", "", "save resume point when max-duration is reached or a chunk fails, and resume from it on next run (use a new output file)")
+	flag.StringVar(&workArgs.LineEnding, "line-ending", "lf", "line ending of csv,jsonl output, support:lf,crlf")
+	flag.BoolVar(&workArgs.BOM, "bom", false, "write UTF-8 BOM at the beginning of csv output, for Excel")
+	flag.StringVar(&workArgs.TargetType, "target-type", "", "transform model: dialect of generated INSERT, support:mysql,postgres, default: db-type")
+	flag.StringVar(&workArgs.Format, "format", "sql", "output format, support:sql, copy (postgres data as COPY FROM stdin blocks), json-map (data as one JSON object keyed by table and primary key), yaml (data as a list of rows per table); from-dump model: csv,jsonl")
+	flag.StringVar(&workArgs.Table, "table", "", "databases tables, all or glob supported, e.g. orders_*")
+	flag.StringVar(&workArgs.TableRegex, "table-regex", "", "select tables whose name matches this regexp, e.g. '^tenant_\\d+_users$'")
+	flag.StringVar(&workArgs.Priority, "priority", "", "export tables matching these patterns first, in order, e.g. orders,users,pay_*")
+	flag.StringVar(&workArgs.ExcludeTable, "exclude-table", "", "with table=all, skip these tables, glob supported, e.g. logs,sessions,audit_*")
+	flag.StringVar(&workArgs.ChangedSince, "changed-since", "", "skip tables not updated since this time (mysql UPDATE_TIME, postgres pg_stat_user_tables), format: YYYY-MM-DD[ HH:MM:SS]")
+	flag.StringVar(&workArgs.Where, "where", "", "filter condition appended to chunked SELECT and COUNT queries")
 	flag.BoolVar(&workArgs.Chunk, "chunk", true, "export all data use chunk")
+	flag.BoolVar(&workArgs.ChunkChecksum, "chunk-checksum", false, "write rows and crc32 comment before each chunk")
+	flag.Var(workArgs.OrderBy, "order-by", "sort exported data of table by columns, format: table:col1,col2, can be repeated")
+	flag.BoolVar(&workArgs.Distinct, "distinct", false, "export data with SELECT DISTINCT")
+	flag.StringVar(&workArgs.DedupeOn, "dedupe-on", "", "skip rows whose values of these columns were already exported, format: col1,col2")
+	flag.BoolVar(&workArgs.IfNotExists, "if-not-exists", false, "schema,all model: write CREATE TABLE IF NOT EXISTS instead of DROP TABLE, keep existing tables and data")
+	flag.StringVar(&workArgs.RenameTable, "rename-table", "", "schema,data,all model: write DROP/CREATE/INSERT for another table name, format: old:new,...")
+	flag.StringVar(&workArgs.TablePrefix, "table-prefix", "", "schema,data,all model: prepend this prefix to table names in DROP/CREATE/INSERT, applied after rename-table, e.g. staging_")
+	flag.BoolVar(&workArgs.KeepAutoIncrement, "keep-auto-increment", false, "schema,all model: keep AUTO_INCREMENT=N in CREATE TABLE so ids continue from the current counter")
+	flag.BoolVar(&workArgs.AddCreateDatabase, "add-create-database", false, "schema,data,all model: write CREATE DATABASE IF NOT EXISTS and USE at the top, as comment for postgres")
+	flag.StringVar(&workArgs.TargetDB, "target-db", "", "schema,data,all,grants,transform model: replace the source database name in CREATE DATABASE/USE and db-qualified identifiers")
+	flag.StringVar(&workArgs.SessionCharset, "session-charset", "", "schema,data,all model: write SET NAMES (mysql) or client_encoding (postgres) at the top, e.g. utf8mb4")
+	flag.StringVar(&workArgs.Escape, "escape", "auto", "string escaping of output values, support:auto (backslash for mysql, ansi for postgres), backslash, ansi (double single quotes, for mysql NO_BACKSLASH_ESCAPES and standard SQL)")
+	flag.StringVar(&workArgs.SessionSQLMode, "session-sql-mode", "-", "schema,data,all model, mysql only: write SET sql_mode at the top, - means not set")
+	flag.StringVar(&workArgs.SessionTimeZone, "session-time-zone", "", "read data in this time zone and write SET time_zone at the top, e.g. UTC, +08:00")
+	flag.BoolVar(&workArgs.DisableChecks, "disable-checks", false, "schema,data,all model: wrap output with FOREIGN_KEY_CHECKS=0/UNIQUE_CHECKS=0 (mysql) or session_replication_role = replica (postgres)")
+	flag.BoolVar(&workArgs.StripDefiner, "strip-definer", false, "transform model: remove DEFINER=user@host from views, triggers, routines and events")
+	flag.StringVar(&workArgs.RewriteDefiner, "rewrite-definer", "", "transform model: replace DEFINER of views, triggers, routines and events with this account, format: user@host")
+	flag.StringVar(&workArgs.RewriteCharset, "rewrite-charset", "", "schema,all,transform model: replace character sets in CREATE statements, format: from:to,..., e.g. utf8:utf8mb4; collations of a replaced charset follow it")
+	flag.StringVar(&workArgs.RewriteCollation, "rewrite-collation", "", "schema,all,transform model: replace collations in CREATE statements, format: from:to,...")
+	flag.StringVar(&workArgs.RewriteEngine, "rewrite-engine", "", "schema,all,transform model: replace storage engines in CREATE TABLE, format: from:to,..., e.g. MyISAM:InnoDB")
+	flag.BoolVar(&workArgs.StripPassword, "strip-password", false, "grants model: do not export password hashes")
+	flag.StringVar(&workArgs.MydumperDir, "mydumper-dir", "", "mysql schema,data,all model: write files in mydumper/myloader layout into this dir instead of output")
+	flag.Int64Var(&workArgs.MydumperFileSize, "mydumper-file-size", 0, "with mydumper-dir, start a new numbered data file after this many MB, 0 means one file per table")
+	flag.StringVar(&workArgs.Bundle, "bundle", "", "data model: write a warehouse load bundle into bundle-dir instead of sql, support:bigquery")
+	flag.StringVar(&workArgs.BundleDir, "bundle-dir", "", "directory of data files, schema files and load script for bundle")
+	flag.StringVar(&workArgs.BundleS3Prefix, "bundle-s3-prefix", "s3://<bucket>/<prefix>", "redshift bundle: S3 path the data files are uploaded to")
+	flag.BoolVar(&workArgs.ColumnStats, "column-stats", false, "bundle: also write <table>.stats.json with per-column min/max/null count, collected in the same pass")
+	flag.StringVar(&workArgs.BundleDataset, "bundle-dataset", "", "target dataset in load script, default: db-name")
+	flag.IntVar(&workArgs.RowsPerInsert, "rows-per-insert", 0, "max rows per INSERT statement, 0 for one statement per chunk")
+	flag.BoolVar(&workArgs.ExtendedInsert, "extended-insert", true, "write multi-row INSERT statements; false writes one INSERT per row, same as -rows-per-insert=1")
+	flag.IntVar(&workArgs.MaxStatementBytes, "max-statement-bytes", 0, "start a new INSERT before a statement exceeds this size, keep it below max_allowed_packet; 0 for no limit")
+	flag.StringVar(&workArgs.InsertMode, "insert-mode", "insert", "data statement: insert, insert-ignore (skip duplicate keys, postgres: ON CONFLICT DO NOTHING) or replace (mysql only, overwrite duplicate keys)")
+	flag.BoolVar(&workArgs.Upsert, "upsert", false, "data model: append ON DUPLICATE KEY UPDATE (postgres: ON CONFLICT DO UPDATE) for every exported column")
+	flag.BoolVar(&workArgs.TruncateBeforeInsert, "truncate-before-insert", false, "data model: write TRUNCATE TABLE before each table's INSERTs")
+	flag.BoolVar(&workArgs.DeleteBeforeInsert, "delete-before-insert", false, "data model: write DELETE FROM table [WHERE where] before each table's INSERTs")
+	flag.Var(workArgs.TableQuery, "table-query", "data model: read rows of a table from a custom SELECT in file instead of the table, format: table=file.sql, repeatable; "+
+		"chunking, where and order-by apply on top of it, so it must return the primary key")
+	flag.BoolVar(&workArgs.ColumnLineage, "column-lineage", false, "data model: comment the source expression of each column in INSERT column lists when table-query, input query, backfill, source-tag-column or history is used")
+	flag.StringVar(&workArgs.AsOf, "as-of", "", "data model: export table state at this timestamp, mariadb system-versioned tables or tables with -validity-columns")
+	flag.StringVar(&workArgs.ValidityColumns, "validity-columns", "", "validity columns of application history tables for -as-of, format: from,to; to NULL means current")
+	flag.BoolVar(&workArgs.History, "history", false, "data model: export all versions of mariadb system-versioned tables with row_start, row_end into <table>_history")
+	flag.Float64Var(&workArgs.ChunkAnomalyFactor, "chunk-anomaly-factor", 10, "warn when a chunk takes more than N times the median of recent chunks, 0 to disable")
+	flag.StringVar(&workArgs.ChunkAnomalyWebhook, "chunk-anomaly-webhook", "", "also POST a json notification of slow chunks to this url")
+	flag.BoolVar(&workArgs.ClusterOrder, "cluster-order", false, "data model: order rows by the primary key of the target table (-target-dsn, default source), so innodb reloads append in order")
+	flag.IntVar(&workArgs.ColumnGroupSize, "column-group-size", 0, "data model: export tables with more columns than N as pk + N column slices in <output>.<table>.partK.sql, with a recombine script")
+	flag.Var(workArgs.Shards, "shard", "data model: export tables selected by -table matching glob as one logical table, format: logical=glob, e.g. orders=orders_*, repeatable")
+	flag.Var(workArgs.Sources, "source", "data model: merge data of shards with identical schema, format: tag=dsn, repeatable; metadata is read from the main connection")
+	flag.StringVar(&workArgs.SourceTagColumn, "source-tag-column", "", "with source, add this column holding the source tag to each row, e.g. region")
+	flag.StringVar(&workArgs.OutfileDir, "outfile-dir", "", "mysql only, fast path: server writes data files with SELECT INTO OUTFILE into this dir, output gets LOAD DATA statements")
+	flag.StringVar(&workArgs.OutfileLocalDir, "outfile-local-dir", "", "local mount of outfile-dir, default: same as outfile-dir")
+	flag.Int64Var(&workArgs.Limit, "limit", 0, "export at most N rows per table (per logical table with -shard), 0 means no limit")
+	flag.StringVar(&workArgs.Sample, "sample", "", "export a subset of rows per table, e.g. 5% (about 5% of rows, pushed into the query as TABLESAMPLE on postgres or a primary key hash on mysql when possible) or 10 (exactly every 10th row in export order)")
+	flag.IntVar(&workArgs.DedupeMaxKey, "dedupe-max-keys", 1000000, "max keys kept in memory for dedupe-on, later unseen keys are not deduped")
+	flag.Int64Var(&workArgs.MaxRowsPerSecond, "max-rows-per-second", 0, "limit rows read from the source per second, shared by all parallel workers; 0 for no limit")
+	flag.Int64Var(&workArgs.MaxBytesPerSecond, "max-bytes-per-second", 0, "limit bytes read from the source per second, shared by all parallel workers; 0 for no limit")
+	flag.IntVar(&workArgs.Parallel, "parallel", 1, "split integer primary key range of table into N segments and export them in parallel")
+	flag.StringVar(&workArgs.TargetDSN, "target-dsn", "", "dsn of target database, columns missing on source are backfilled in INSERT")
+	flag.StringVar(&workArgs.TargetDDL, "target-ddl", "", "file with target CREATE TABLE statements, columns missing on source are backfilled in INSERT")
+	flag.Var(workArgs.Mask, "mask", "mask column values before writing, format: [table.]col=rule, rule: null, fixed:value, shuffle, partial[:n] (keep n chars, default 1, e.g. j***@example.com), can be repeated")
+	flag.StringVar(&workArgs.MaskFile, "mask-file", "", "file of mask rules, one [table.]col=rule per line, # for comments; -mask on the command line takes precedence")
+	flag.Var(workArgs.Backfill, "backfill", "value of backfilled column, format: [table.]col=value, can be repeated, default: DEFAULT")
+	flag.BoolVar(&workArgs.SourcePosition, "source-position", false, "record binlog/gtid (mysql) or wal lsn (postgres) position in dump header and output.position file")
+	flag.StringVar(&workArgs.IncrementalColumn, "incremental-column", "", "export only rows whose column is greater than -since or the value saved in -state-file, as upsert statements")
+	flag.StringVar(&workArgs.Since, "since", "", "low watermark of incremental-column, overrides state-file")
+	flag.StringVar(&workArgs.StateFile, "state-file", "", "json file keeping high watermark of incremental-column per table")
 	flag.StringVar(&workArgs.Input, "input", "", "export query sql filename")
 	flag.StringVar(&workArgs.Output, "output", "", "output file")
+	flag.Int64Var(&workArgs.MaxTotalRows, "max-total-rows", 0, "abort when the export writes more rows in total, 0 for no limit")
+	flag.Int64Var(&workArgs.MaxTotalBytes, "max-total-bytes", 0, "abort when the export writes more bytes of data in total, 0 for no limit")
+	flag.BoolVar(&workArgs.Force, "force", false, "only warn when max-total-rows or max-total-bytes is exceeded")
+	flag.BoolVar(&workArgs.JSONCast, "json-cast", false, "write json columns as CAST('...' AS JSON) (mysql) or '...'::jsonb (postgres)")
+	flag.StringVar(&workArgs.PrimeScript, "prime-script", "", "also write a script that warms the cache for exported tables and indexes after import (mysql: FORCE INDEX scans, postgres: pg_prewarm)")
 	flag.StringVar(&workArgs.SkipField, "skip-field", "", "set skip field when create INSERT sql")
+	flag.StringVar(&workArgs.OnlyField, "only-field", "", "only export these fields in INSERT sql, format: col1,col2")
 	flag.BoolVar(&workArgs.Help, "h", false, "show usage and exit")
+	flag.StringVar(&workArgs.LineageFormat, "lineage-format", "json", "lineage model output format, support:json,dot")
+	flag.IntVar(&workArgs.LintVarcharMax, "lint-varchar-max", 1024, "lint model: report varchar columns wider than this, 0 to disable")
+	flag.Float64Var(&workArgs.Chaos.QueryErrorRate, "chaos-query-error-rate", 0, "fault injection: fail this fraction of data queries")
+	flag.Float64Var(&workArgs.Chaos.SlowChunkRate, "chaos-slow-chunk-rate", 0, "fault injection: delay this fraction of data queries by -chaos-slow-chunk")
+	flag.DurationVar(&workArgs.Chaos.SlowChunk, "chaos-slow-chunk", time.Second, "fault injection: delay of a slow chunk")
+	flag.Float64Var(&workArgs.Chaos.WriteErrorRate, "chaos-write-error-rate", 0, "fault injection: fail this fraction of chunk writes")
+	flag.Int64Var(&workArgs.Chaos.Seed, "chaos-seed", 0, "fault injection: random seed, 0 for a time based seed")
+	hiddenFlag("chaos-query-error-rate", "chaos-slow-chunk-rate", "chaos-slow-chunk", "chaos-write-error-rate", "chaos-seed")
+
+	flagAlias("m", "model")
+	flagAlias("t", "table")
+	flagAlias("o", "output")
+	flagAlias("i", "input")
+	flagAlias("w", "where")
+	flagAlias("d", "db-name")
+	flagAlias("u", "db-user")
+	flagAlias("no-drop", "if-not-exists")
+	flagAlias("tz", "session-time-zone")
+	deprecatedFlag("db-pwd", "db-password")
+	deprecatedFlag("db-pwd-file", "db-password-file")
 
 	flag.Usage = usage
 }
@@ -75,43 +386,101 @@ func usage() {
 	_, _ = fmt.Fprintf(os.Stdout, programName+`
 Usage:
   ./%s -h
-  ./%s -db-type=mysql,postgres -db-name=db --table=t1,t2...|all -db-host=host -db-user=user -db-pwd=pwd [--output=./output]
-  ./%s -db-type=mysql,postgres --model=data -db-host=host -db-user=user -db-pwd=pwd --table=tb --chunk=true|false --input=./input.sql [--skip-field=f1,f2...] [--output=./output.sql]
-`, programName, programName, programName)
-
-	flag.PrintDefaults()
+  ./%s -db-type=mysql,postgres -db-name=db --table=t1,t2...|all -db-host=host -db-user=user -db-password=pwd [--output=./output]
+  ./%s -db-type=mysql,postgres -dsn=dsn --table=t1,t2...|all [--output=./output]
+  ./%s -db-type=mysql --model=lint -db-name=db --table=t1,t2...|all -db-host=host -db-user=user -db-password=pwd [--lint-varchar-max=1024] [--output=./output]
+  ./%s -db-type=mysql,postgres --model=validate -db-name=db --table=t1,t2...|all -db-host=host -db-user=user -db-password=pwd [--where=cond] [--only-field=f1,f2...] [--order-by=t:col]
+  ./%s -db-type=mysql,postgres --model=lineage -db-name=db -db-host=host -db-user=user -db-password=pwd [--lineage-format=json|dot] [--output=./output]
+  ./%s -db-type=mysql,postgres --model=grants -db-name=db -db-host=host -db-user=user -db-password=pwd [--strip-password] [--output=./output.sql]
+  ./%s -db-type=mysql,postgres --model=from-dump --input=./backup.sql --table=t1,t2...|all --format=csv|jsonl [--skip-field=f1,f2...] [--output=./output]
+  ./%s -db-type=mysql,postgres --model=transform --input=./backup.sql --table=t1,t2...|all [--skip-field=f1,f2...] [--target-type=mysql|postgres] [--output=./output.sql]
+  ./%s -db-type=mysql,postgres --model=data -db-host=host -db-user=user -db-password=pwd --table=tb --chunk=true|false --input=./input.sql [--where=cond] [--skip-field=f1,f2...] [--output=./output.sql]
+  ./%s -db-type=mysql --model=all -db-name=db --table=t1,t2...|all -db-host=host -db-user=user -db-password=pwd [--output=./output.sql]
+`, programName, programName, programName, programName, programName, programName, programName, programName, programName, programName, programName)
+
+	printFlagGroups()
 	os.Exit(0)
 }
 
 func main() {
 	flag.Parse()
+	warnDeprecatedFlags()
+
+	// -mask-file 的规则和 -mask 一样属于命令行设置, 在预设之前读取, 同一列不被预设的规则覆盖
+	if len(workArgs.MaskFile) > 0 {
+		if err := loadMaskFile(workArgs.MaskFile, workArgs.Mask); err != nil {
+			errMsg(fmt.Sprintf("can not read mask-file: %s, err: %v", workArgs.MaskFile, err), 13)
+		}
+	}
+	if len(workArgs.Preset) > 0 {
+		if err := applyPreset(workArgs.Preset); err != nil {
+			errMsg(err.Error(), 11)
+		}
+	}
 
 	if workArgs.Help {
 		flag.Usage()
 	}
 
-	if len(workArgs.Database) == 0 {
+	// 离线模式只读取已有的导出文件, 不连接数据库
+	offline := workArgs.Model == "from-dump" || workArgs.Model == "transform"
+	// 回放录制文件时同样不需要连接参数
+	noConn := offline || len(workArgs.Replay) > 0
+
+	if len(workArgs.Database) == 0 && len(workArgs.DSN) == 0 && !noConn {
 		flag.Usage()
 	}
 
+	if len(workArgs.DbPwdFile) > 0 && workArgs.AskPass {
+		errMsg("db-password-file and ask-pass can not be used together", 16)
+	}
+
+	if len(workArgs.DbPwdFile) > 0 {
+		pwd, err := tools.ReadPasswordFile(workArgs.DbPwdFile)
+		if err != nil {
+			errMsg(fmt.Sprintf("can not read password file: %s, err: %v", workArgs.DbPwdFile, err), 16)
+		}
+		workArgs.DbPassword = pwd
+	}
+
+	if workArgs.AskPass {
+		pwd, err := tools.AskPassword(fmt.Sprintf("password for %s: ", workArgs.DbUser))
+		if err != nil {
+			errMsg(fmt.Sprintf("can not read password, err: %v", err), 16)
+		}
+		workArgs.DbPassword = pwd
+	}
+
+	if len(workArgs.DSN) == 0 && (workArgs.DbUser == "" || workArgs.DbPassword == "") && !noConn {
+		loadClientCredentials(&workArgs)
+	}
+
 	if workArgs.DbType != "mysql" && workArgs.DbType != "postgres" {
 		errMsg("need to set db type: mysql | postgres", 8)
 	}
 
-	if workArgs.DbHost == "" {
+	if workArgs.DbHost == "" && len(workArgs.DSN) == 0 && !noConn {
 		errMsg("please set db host", 9)
 	}
 
-	if workArgs.DbUser == "" {
+	if workArgs.DbUser == "" && len(workArgs.DSN) == 0 && !noConn {
 		errMsg("please set db user", 10)
 	}
 
-	if workArgs.Model != "schema" && workArgs.Model != "data" {
+	if workArgs.Model != "schema" && workArgs.Model != "data" && workArgs.Model != "lint" && workArgs.Model != "lineage" && workArgs.Model != "from-dump" && workArgs.Model != "transform" && workArgs.Model != "all" && workArgs.Model != "grants" && workArgs.Model != "validate" {
 		errMsg(fmt.Sprintf("no support model: %s", workArgs.Model), 11)
 	}
 
-	if workArgs.Model == "schema" && len(workArgs.Table) == 0 {
-		errMsg("export schema, but no table assign.", 12)
+	if (workArgs.Model == "schema" || workArgs.Model == "lint" || workArgs.Model == "all" || workArgs.Model == "validate") && len(workArgs.Table) == 0 {
+		errMsg(fmt.Sprintf("%s model, but no table assign.", workArgs.Model), 12)
+	}
+
+	if len(workArgs.ChangedSince) > 0 {
+		since, err := parseChangedSince(workArgs.ChangedSince)
+		if err != nil {
+			errMsg(err.Error(), 17)
+		}
+		workArgs.ChangedSince = since
 	}
 
 	if workArgs.Model == "data" {
@@ -120,260 +489,1480 @@ func main() {
 		}
 	}
 
-	if len(workArgs.Table) <= 0 {
-		errMsg("please assign table name.", 14)
+	if workArgs.Model == "all" && !workArgs.Chunk {
+		errMsg("all model need chunk=true", 13)
 	}
 
-	// 连接数据库
-	var errDB error
-	if workArgs.DbType == "mysql" {
-		workArgs.EscapeFunc = tools.AddSlashes
-		dsn := fmt.Sprintf(`%s:%s@tcp(%s)/%s?charset=%s`, workArgs.DbUser, workArgs.DbPassword, workArgs.DbHost, workArgs.Database, workArgs.DbCharset)
-		workArgs.DB, errDB = sql.Open("mysql", dsn)
-		if errDB != nil {
-			errMsg(fmt.Sprintf("can not connect to mysql, dsn: %s, err: %v", dsn, errDB), 110)
-		}
-	} else {
-		workArgs.EscapeFunc = tools.PgEscape
-		dsn := fmt.Sprintf(`postgres://%s:%s@%s/%s`, workArgs.DbUser, workArgs.DbPassword, workArgs.DbHost, workArgs.Database)
-		workArgs.DB, errDB = sql.Open("postgres", dsn)
-		if errDB != nil {
-			errMsg(fmt.Sprintf("can not connect to postgres, dsn: %s, err: %v", dsn, errDB), 111)
-		}
+	if offline && len(workArgs.Input) == 0 {
+		errMsg(fmt.Sprintf("%s model, but no dump file assign.", workArgs.Model), 13)
 	}
 
-	errDB = workArgs.DB.Ping()
-	if errDB != nil {
-		panic(errDB)
+	if workArgs.Model == "from-dump" && workArgs.Format != "csv" && workArgs.Format != "jsonl" {
+		errMsg(fmt.Sprintf("from-dump model no support format: %s", workArgs.Format), 11)
 	}
 
-	doWork(workArgs)
+	if workArgs.LineEnding != "lf" && workArgs.LineEnding != "crlf" {
+		errMsg(fmt.Sprintf("no support line ending: %s", workArgs.LineEnding), 11)
+	}
 
-	// 关闭数据库连接
-	if workArgs.DB != nil {
-		_ = workArgs.DB.Close()
+	if workArgs.LineEnding == "crlf" && workArgs.Format != "csv" && workArgs.Format != "jsonl" {
+		errMsg("line-ending crlf only support csv,jsonl format", 11)
+	}
+	// BOM 只用于 Excel 打开 csv, 写在 SQL 或 JSON 开头会导致导入失败
+	if workArgs.BOM && workArgs.Format != "csv" {
+		errMsg("bom only support csv format", 11)
 	}
-}
 
-func doWork(workArgs workArgsT) {
-	var output = os.Stdout
-	if len(workArgs.Output) > 0 {
-		f, err := os.Create(workArgs.Output)
-		if err != nil {
-			log.Printf("[doWork] can open file: %s, err: %s", workArgs.Output, err.Error())
-			os.Exit(20)
-		}
-		defer func() {
-			_ = f.Close()
-		}()
+	if len(workArgs.TargetType) == 0 {
+		workArgs.TargetType = workArgs.DbType
+	}
+	if workArgs.TargetType != "mysql" && workArgs.TargetType != "postgres" {
+		errMsg("need to set target type: mysql | postgres", 8)
+	}
 
-		output = f
+	if len(workArgs.IncrementalColumn) > 0 && !workArgs.Chunk {
+		errMsg("incremental-column need chunk=true", 13)
 	}
 
-	timeNow := time.Now()
-	comment := fmt.Sprintf("/* export %s by %s at: %d-%02d-%02d %02d:%02d:%02d */\n\n", workArgs.Model, programName,
-		timeNow.Year(), int(timeNow.Month()), timeNow.Day(),
-		timeNow.Hour(), timeNow.Minute(), timeNow.Second())
-	_, err := output.WriteString(comment)
-	if err != nil {
-		log.Printf("[doWork] write err: %v", err)
+	if workArgs.Escape != "auto" && workArgs.Escape != "backslash" && workArgs.Escape != "ansi" {
+		errMsg(fmt.Sprintf("no support escape: %s", workArgs.Escape), 11)
+	}
+	if workArgs.Escape == "backslash" && workArgs.DbType == "postgres" {
+		errMsg("escape backslash only support mysql", 13)
+	}
+	if workArgs.Escape == "ansi" && workArgs.DbType == "mysql" && workArgs.SessionSQLMode != "-" &&
+		!strings.Contains(strings.ToUpper(workArgs.SessionSQLMode), "NO_BACKSLASH_ESCAPES") {
+		errMsg("escape ansi need NO_BACKSLASH_ESCAPES in session-sql-mode", 13)
 	}
 
-	if workArgs.Model == "schema" {
-		doWorkExportSchema(workArgs, output)
-	} else {
-		doWorkExportData(workArgs, output)
+	if len(workArgs.SessionTimeZone) > 0 {
+		if _, err := loadTimeZone(workArgs.SessionTimeZone); err != nil {
+			errMsg(fmt.Sprintf("invalid session-time-zone: %s, %v", workArgs.SessionTimeZone, err), 13)
+		}
+		if workArgs.DbType == "mysql" && strings.EqualFold(workArgs.SessionTimeZone, "UTC") {
+			// mysql 未导入时区表时不认识 UTC, 使用等价的偏移
+			workArgs.SessionTimeZone = "+00:00"
+		}
 	}
-}
 
-func doWorkExportSchema(workArgs workArgsT, output *os.File) {
-	log.Printf("[doWorkExportSchem] start work")
+	if workArgs.MaxDuration > 0 {
+		if workArgs.Parallel > 1 {
+			errMsg("max-duration can not be used with parallel", 13)
+		}
+		workArgs.Deadline = time.Now().Add(workArgs.MaxDuration)
+	}
+	// 去重集合, 抽样计数和增量水位只在内存中, 从断点继续时无法恢复
+	if len(workArgs.CheckpointFile) > 0 && (len(workArgs.DedupeOn) > 0 || workArgs.Limit > 0 || len(workArgs.Sample) > 0 || len(workArgs.StateFile) > 0) {
+		errMsg("checkpoint-file can not be used with dedupe-on, limit, sample, state-file", 13)
+	}
 
-	var tables []string
+	for _, name := range strings.Split(workArgs.Table, ",") {
+		if isSystemObject(name) && (workArgs.Upsert || len(workArgs.IncrementalColumn) > 0 || workArgs.Parallel > 1 ||
+			len(workArgs.CheckpointFile) > 0 || len(workArgs.OutfileDir) > 0 || workArgs.InsertMode != "insert") {
+			errMsg(fmt.Sprintf("system object %s is exported as a read-only snapshot, can not be used with upsert, incremental-column, parallel, checkpoint-file, outfile-dir, insert-mode", name), 13)
+		}
+	}
 
-	if workArgs.Table == "all" {
-		querySQL := "SHOW TABLES"
-		log.Printf("[doWorkExportSchema] sql: %s", querySQL)
+	if workArgs.StripDefiner && len(workArgs.RewriteDefiner) > 0 {
+		errMsg("strip-definer and rewrite-definer can not be used together", 13)
+	}
+	if len(workArgs.RewriteDefiner) > 0 && strings.LastIndex(workArgs.RewriteDefiner, "@") <= 0 {
+		errMsg(fmt.Sprintf("invalid rewrite-definer: %s, format: user@host", workArgs.RewriteDefiner), 13)
+	}
 
-		rows, err := workArgs.DB.Query(querySQL)
+	if len(workArgs.RewriteCharset) > 0 {
+		renames, err := tools.ParseRenames(workArgs.RewriteCharset)
 		if err != nil {
-			panic(err)
+			errMsg(fmt.Sprintf("invalid rewrite-charset: %v", err), 13)
 		}
-
-		for rows.Next() {
-			cols, _ := rows.Columns()
-			colsNum := len(cols)
-			refs := make([]interface{}, colsNum)
-			for i := range refs {
-				var ref interface{}
-				refs[i] = &ref
-			}
-			errS := rows.Scan(refs...)
-			if errS != nil {
-				log.Printf("[doWorkExportSchema] rows.Scan err: %v", errS)
-			}
-
-			for k, _ := range cols {
-				val := reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
-				tableName := fmt.Sprintf("%s", val)
-				tables = append(tables, tableName)
-			}
+		workArgs.CharsetMap = renames
+	}
+	if len(workArgs.RewriteCollation) > 0 {
+		renames, err := tools.ParseRenames(workArgs.RewriteCollation)
+		if err != nil {
+			errMsg(fmt.Sprintf("invalid rewrite-collation: %v", err), 13)
 		}
-	} else {
-		tables = strings.Split(workArgs.Table, ",")
+		workArgs.CollationMap = renames
 	}
-	//logs.Debug("[doWorkExportSchem] tables: %#v\n", tables)
-
-	for _, tbl := range tables {
-		addIf := fmt.Sprintf("DROP TABLE IF EXISTS %s;\n", tbl)
-		_, errW := output.WriteString(addIf)
-		if errW != nil {
-			log.Printf("[doWorkExportSchema] write err: %v", errW)
+	if len(workArgs.RenameTable) > 0 {
+		renames, err := tools.ParseRenames(workArgs.RenameTable)
+		if err != nil {
+			errMsg(fmt.Sprintf("invalid rename-table: %v", err), 13)
+		}
+		workArgs.TableRenames = renames
+	}
+	if len(workArgs.RewriteEngine) > 0 {
+		renames, err := tools.ParseRenames(workArgs.RewriteEngine)
+		if err != nil {
+			errMsg(fmt.Sprintf("invalid rewrite-engine: %v", err), 13)
 		}
+		workArgs.EngineMap = renames
+	}
 
-		querySQL := fmt.Sprintf("SHOW CREATE TABLE %s", tbl)
-		log.Printf("[doWorkExportSchem] sql: %s", querySQL)
+	if len(workArgs.DbSchema) > 0 && workArgs.DbType != "postgres" {
+		errMsg("db-schema only support postgres", 13)
+	}
 
-		var createSQL = ""
+	if workArgs.MaxRowsPerSecond < 0 || workArgs.MaxBytesPerSecond < 0 {
+		errMsg("max-rows-per-second and max-bytes-per-second must not be negative", 13)
+	}
+	workArgs.Throttle = newRateLimiter(workArgs.MaxRowsPerSecond, workArgs.MaxBytesPerSecond)
 
-		rows, err := workArgs.DB.Query(querySQL)
+	if len(workArgs.Mask) > 0 {
+		// SELECT INTO OUTFILE 由服务端写出, 不经过逐行处理, 无法脱敏
+		if len(workArgs.OutfileDir) > 0 {
+			errMsg("mask is not supported with outfile-dir", 13)
+		}
+		masker, err := newDataMasker(workArgs.Mask)
 		if err != nil {
-			panic(err)
+			errMsg(fmt.Sprintf("invalid mask: %v", err), 13)
 		}
+		workArgs.Masker = masker
+	}
 
-		for rows.Next() {
-			cols, _ := rows.Columns()
-			colsNum := len(cols)
-			refs := make([]interface{}, colsNum)
-			for i := range refs {
-				var ref interface{}
-				refs[i] = &ref
-			}
-			_ = rows.Scan(refs...)
-
-			for k, col := range cols {
-				log.Printf("col:", col)
-				if col == "Create Table" {
-					val := reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
-					createSQL = fmt.Sprintf("%s;\n", val)
-				}
-			}
+	for _, pattern := range strings.Split(workArgs.Table+","+workArgs.ExcludeTable+","+workArgs.Priority, ",") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errMsg(fmt.Sprintf("invalid table pattern: %s", pattern), 13)
 		}
+	}
 
-		re := regexp.MustCompile(`AUTO_INCREMENT=(\d+) `)
-		createSQL = re.ReplaceAllString(createSQL, "")
+	if workArgs.Limit < 0 {
+		errMsg("limit must not be negative", 13)
+	}
+	if _, err := newRowSampler(workArgs.Limit, workArgs.Sample); err != nil {
+		errMsg(err.Error(), 13)
+	}
 
-		_, _ = output.WriteString(createSQL)
-		_, _ = output.WriteString("\n")
+	if len(workArgs.Bundle) > 0 {
+		if workArgs.Bundle != "bigquery" && workArgs.Bundle != "snowflake" && workArgs.Bundle != "redshift" {
+			errMsg(fmt.Sprintf("no support bundle: %s", workArgs.Bundle), 11)
+		}
+		if workArgs.Model != "data" || !workArgs.Chunk || len(workArgs.BundleDir) == 0 {
+			errMsg("bundle need data model with chunk=true and bundle-dir", 13)
+		}
 	}
 
-	log.Printf("[doWorkExportSchem] jobs have done.")
-}
+	if workArgs.RowsPerInsert < 0 || workArgs.MaxStatementBytes < 0 {
+		errMsg("rows-per-insert and max-statement-bytes can not be negative", 13)
+	}
+	if !workArgs.ExtendedInsert {
+		if workArgs.RowsPerInsert > 1 {
+			errMsg("extended-insert=false can not be used with rows-per-insert", 13)
+		}
+		workArgs.RowsPerInsert = 1
+	}
 
-func doWorkExportData(workArgs workArgsT, output *os.File) {
-	log.Printf("[doWorkExportData] start work")
+	if workArgs.InsertMode != "insert" {
+		if workArgs.InsertMode != "insert-ignore" && workArgs.InsertMode != "replace" {
+			errMsg(fmt.Sprintf("no support insert mode: %s", workArgs.InsertMode), 11)
+		}
+		if workArgs.DbType != "mysql" && workArgs.InsertMode != "insert-ignore" {
+			errMsg("insert-mode replace only support mysql", 13)
+		}
+		if len(workArgs.IncrementalColumn) > 0 || workArgs.Upsert {
+			errMsg("insert-mode can not be used with upsert or incremental-column", 13)
+		}
+	}
 
-	if workArgs.Chunk {
-		log.Printf("[doWorkExportData] use chunk")
-		const chunkSize int64 = 1000
+	if workArgs.TruncateBeforeInsert || workArgs.DeleteBeforeInsert {
+		if workArgs.TruncateBeforeInsert && workArgs.DeleteBeforeInsert {
+			errMsg("truncate-before-insert and delete-before-insert can not be used together", 13)
+		}
+		if len(workArgs.IncrementalColumn) > 0 {
+			errMsg("truncate-before-insert and delete-before-insert can not be used with incremental-column", 13)
+		}
+	}
 
-		var total int64
-		totalSQL := fmt.Sprintf(`SELECT COUNT(*) AS total FROM %s`, workArgs.Table)
-		row := workArgs.DB.QueryRow(totalSQL)
-		err := row.Scan(&total)
-		if err != nil {
-			panic(err)
+	if len(workArgs.MydumperDir) > 0 {
+		if workArgs.DbType != "mysql" || (workArgs.Model != "schema" && workArgs.Model != "data" && workArgs.Model != "all") || !workArgs.Chunk {
+			errMsg("mydumper-dir only support mysql schema,data,all model with chunk=true", 13)
 		}
+		if len(workArgs.Bundle) > 0 {
+			errMsg("mydumper-dir can not be used with bundle", 13)
+		}
+	}
 
-		var pageTotal int64 = int64(math.Ceil(float64(total) / float64(chunkSize)))
-		log.Printf("[doWorkExportData] pageTotal: %d", pageTotal)
+	if workArgs.ColumnStats && len(workArgs.Bundle) == 0 {
+		errMsg("column-stats need bundle", 13)
+	}
 
-		for i := int64(0); i < pageTotal; i++ {
-			offset := i * chunkSize
-			querySQL := fmt.Sprintf(`SELECT * FROM %s LIMIT %d OFFSET %d`, workArgs.Table, chunkSize, offset)
-			log.Printf("[doWorkExportData] sql: %s", querySQL)
-			_, _ = output.WriteString(fmt.Sprintf("/** chunk: %d */\n", i))
-			doWorkExportDataUseChunk(workArgs, output, querySQL)
-		}
-	} else {
-		sqlBytes, err := ioutil.ReadFile(workArgs.Input)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stdout, "cat not read sql file:%s, err: %s\n", workArgs.Input, err.Error())
-			os.Exit(30)
+	if len(workArgs.Shards) > 0 && (workArgs.Model != "data" || !workArgs.Chunk || len(workArgs.Sources) > 0) {
+		errMsg("shard only support data model with chunk=true, and can not be used with source", 13)
+	}
+	for _, pattern := range workArgs.Shards {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errMsg(fmt.Sprintf("invalid shard pattern: %s", pattern), 13)
 		}
+	}
 
-		querySQL := string(sqlBytes)
-		doWorkExportDataUseChunk(workArgs, output, querySQL)
+	if len(workArgs.SourceTagColumn) > 0 && len(workArgs.Sources) == 0 {
+		errMsg("source-tag-column need source", 13)
+	}
+	if workArgs.Format == "copy" {
+		if workArgs.DbType != "postgres" || (workArgs.Model != "data" && workArgs.Model != "all") {
+			errMsg("format copy only support postgres data and all model", 11)
+		}
+		if workArgs.Upsert || len(workArgs.IncrementalColumn) > 0 || workArgs.InsertMode != "insert" ||
+			len(workArgs.TargetDSN) > 0 || len(workArgs.TargetDDL) > 0 {
+			errMsg("format copy can not be used with upsert, incremental-column, insert-mode, target-dsn, target-ddl", 13)
+		}
+	} else if workArgs.Format == "json-map" || workArgs.Format == "yaml" {
+		if workArgs.Model != "data" {
+			errMsg(fmt.Sprintf("format %s only support data model", workArgs.Format), 11)
+		}
+		if len(workArgs.Sources) > 0 || len(workArgs.Bundle) > 0 || len(workArgs.MydumperDir) > 0 || workArgs.ColumnGroupSize > 0 || workArgs.SourcePosition {
+			errMsg(fmt.Sprintf("format %s can not be used with source, bundle, mydumper-dir, column-group-size, source-position", workArgs.Format), 13)
+		}
+	} else if workArgs.Format != "sql" && workArgs.Model != "from-dump" {
+		errMsg(fmt.Sprintf("no support format: %s", workArgs.Format), 11)
 	}
 
-	log.Printf("[doWorkExportData] jobs have done.")
-}
+	if len(workArgs.ValidityColumns) > 0 && (len(workArgs.AsOf) == 0 || len(strings.Split(workArgs.ValidityColumns, ",")) != 2) {
+		errMsg("validity-columns need as-of, format: from,to", 13)
+	}
+	if len(workArgs.AsOf) > 0 || workArgs.History {
+		if len(workArgs.AsOf) > 0 && workArgs.History {
+			errMsg("as-of and history can not be used together", 13)
+		}
+		if len(workArgs.ValidityColumns) == 0 && workArgs.DbType != "mysql" {
+			errMsg("system-versioned tables only support mariadb, set validity-columns for history tables", 13)
+		}
+		if !workArgs.Chunk || len(workArgs.TableQuery) > 0 || len(workArgs.OutfileDir) > 0 {
+			errMsg("as-of and history need chunk=true, and can not be used with table-query, outfile-dir", 13)
+		}
+	}
 
-func doWorkExportDataUseChunk(workArgs workArgsT, output *os.File, querySQL string) {
-	log.Printf("[doWorkExportDataUseChunk] chunk jobs start.")
-	log.Printf("sql:", querySQL)
+	if len(workArgs.PrimeScript) > 0 && workArgs.Model != "schema" && workArgs.Model != "data" && workArgs.Model != "all" {
+		errMsg("prime-script only support schema, data and all model", 13)
+	}
 
-	rows, err := workArgs.DB.Query(querySQL)
-	if err != nil {
-		panic(err)
+	if workArgs.ClusterOrder && (!workArgs.Chunk || len(workArgs.OrderBy) > 0) {
+		errMsg("cluster-order need chunk=true, and can not be used with order-by", 13)
 	}
 
-	var fieldBox []string
-	var skipFieldBox = make(map[string]bool)
-	expSkipField := strings.Split(workArgs.SkipField, ",")
-	if len(expSkipField) > 0 {
-		for _, field := range expSkipField {
-			skipFieldBox[field] = true
+	if workArgs.ColumnGroupSize > 0 {
+		if workArgs.Model != "data" || !workArgs.Chunk || len(workArgs.Output) == 0 {
+			errMsg("column-group-size only support data model with chunk=true and output", 13)
+		}
+		if len(workArgs.Sources) > 0 || workArgs.MaxDuration > 0 || len(workArgs.OutfileDir) > 0 || len(workArgs.DedupeOn) > 0 {
+			errMsg("column-group-size can not be used with source, max-duration, outfile-dir, dedupe-on", 13)
 		}
 	}
 
-	var columns []string
-	var colsNum int
-	var i int
-	for rows.Next() {
-		if i == 0 {
-			columns, _ = rows.Columns()
-			for _, col := range columns {
-				if skipFieldBox[col] {
-					continue
-				}
-				fieldBox = append(fieldBox, col)
+	if len(workArgs.TableQuery) > 0 {
+		if len(workArgs.OutfileDir) > 0 {
+			errMsg("table-query can not be used with outfile-dir", 13)
+		}
+		workArgs.TableSQL = make(map[string]string)
+		for tbl, filename := range workArgs.TableQuery {
+			query, err := readInputSQL(filename)
+			if err != nil {
+				errMsg(fmt.Sprintf("can not read table query file: %s, err: %v", filename, err), 30)
 			}
-			colsNum = len(columns)
+			workArgs.TableSQL[tbl] = query
+		}
+	}
 
-			initSql := fmt.Sprintf("INSERT INTO `%s` (`%s`) VALUES\n", workArgs.Table, strings.Join(fieldBox, "`, `"))
-			_, _ = output.WriteString(initSql)
-		} else {
-			_, _ = output.WriteString(",\n")
+	for _, rate := range []float64{workArgs.Chaos.QueryErrorRate, workArgs.Chaos.SlowChunkRate, workArgs.Chaos.WriteErrorRate} {
+		if rate < 0 || rate > 1 {
+			errMsg("chaos rates must be between 0 and 1", 13)
 		}
+	}
 
-		//fmt.Println("fieldBox:", fieldBox)
-		//fmt.Println("skipFieldBox:", skipFieldBox)
+	if len(workArgs.Record) > 0 && len(workArgs.Replay) > 0 {
+		errMsg("record and replay can not be used together", 13)
+	}
+	if (len(workArgs.Record) > 0 || len(workArgs.Replay) > 0) && len(workArgs.Sources) > 0 {
+		errMsg("record and replay can not be used with source", 13)
+	}
 
-		var values []string
-		refs := make([]interface{}, colsNum)
-		for i := range refs {
-			var ref interface{}
-			refs[i] = &ref
+	if len(workArgs.Sources) > 0 {
+		if workArgs.Model != "data" || !workArgs.Chunk {
+			errMsg("source only support data model with chunk=true", 13)
 		}
-		_ = rows.Scan(refs...)
+		if len(workArgs.IncrementalColumn) > 0 || workArgs.MaxDuration > 0 || len(workArgs.OutfileDir) > 0 {
+			errMsg("source can not be used with incremental-column, max-duration, outfile-dir", 13)
+		}
+	}
 
-		for k, col := range columns {
-			if skipFieldBox[col] {
-				continue
-			}
-			val := reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
-			ve := fmt.Sprintf(`%s`, val)
-			values = append(values, fmt.Sprintf(`'%s'`, workArgs.EscapeFunc(ve)))
+	if len(workArgs.OutfileDir) > 0 {
+		if workArgs.DbType != "mysql" || !workArgs.Chunk {
+			errMsg("outfile-dir only support mysql with chunk=true", 13)
 		}
-		vSql := fmt.Sprintf("(%s)", strings.Join(values, ", "))
+		if len(workArgs.SkipField) > 0 || len(workArgs.OnlyField) > 0 || len(workArgs.DedupeOn) > 0 || len(workArgs.Sample) > 0 ||
+			len(workArgs.IncrementalColumn) > 0 || workArgs.Parallel > 1 || workArgs.MaxDuration > 0 {
+			errMsg("outfile-dir can not be used with skip-field, only-field, dedupe-on, sample, incremental-column, parallel, max-duration", 13)
+		}
+	}
 
-		_, _ = output.WriteString(vSql)
-		i++
+	if workArgs.Model == "lineage" && workArgs.LineageFormat != "json" && workArgs.LineageFormat != "dot" {
+		errMsg(fmt.Sprintf("no support lineage format: %s", workArgs.LineageFormat), 11)
+	}
+
+	if len(workArgs.TableRegex) > 0 {
+		re, err := regexp.Compile(workArgs.TableRegex)
+		if err != nil {
+			errMsg(fmt.Sprintf("invalid table-regex: %v", err), 13)
+		}
+		workArgs.TableRegexp = re
+		if len(workArgs.Table) == 0 {
+			workArgs.Table = "all"
+		}
+	}
+
+	if len(workArgs.Table) <= 0 && workArgs.Model != "lineage" && workArgs.Model != "grants" {
+		errMsg("please assign table name.", 14)
+	}
+
+	workArgs.Logger = log.New(os.Stderr, "", log.LstdFlags)
+
+	if workArgs.DbType == "mysql" {
+		workArgs.QueryEscapeFunc = tools.AddSlashes
+	} else {
+		workArgs.QueryEscapeFunc = tools.PgEscape
+	}
+	switch workArgs.Escape {
+	case "auto":
+		workArgs.EscapeFunc = workArgs.QueryEscapeFunc
+	case "backslash":
+		workArgs.EscapeFunc = tools.AddSlashes
+	case "ansi":
+		workArgs.EscapeFunc = tools.PgEscape
+	}
 
+	if offline {
+		doWork(workArgs)
+		return
 	}
 
-	_, _ = output.WriteString(";\n\n")
+	// 连接数据库, -replay 时不连接, 查询结果来自录制文件
+	var pool *sql.DB
+	if len(workArgs.Replay) > 0 {
+		store, err := loadFixtures(workArgs.Replay)
+		if err != nil {
+			errMsg(fmt.Sprintf("can not read replay file: %s, err: %v", workArgs.Replay, err), 30)
+		}
+		pool = sql.OpenDB(&fixtureConnector{store: store})
+	} else {
+		dsn, errDSN := buildDSN(workArgs)
+		if errDSN != nil {
+			errMsg(fmt.Sprintf("can not build %s dsn, err: %v", workArgs.DbType, errDSN), 15)
+		}
+
+		var errDB error
+		if workArgs.DbType == "mysql" {
+			pool, errDB = sql.Open("mysql", dsn)
+			if errDB != nil {
+				errMsg(fmt.Sprintf("can not connect to mysql, dsn: %s, err: %v", dsn, errDB), 110)
+			}
+		} else {
+			pool, errDB = sql.Open("postgres", dsn)
+			if errDB != nil {
+				errMsg(fmt.Sprintf("can not connect to postgres, dsn: %s, err: %v", dsn, errDB), 111)
+			}
+		}
+
+		errDB = pool.Ping()
+		if errDB != nil {
+			panic(errDB)
+		}
+	}
+
+	var recorder *fixtureConnector
+	if len(workArgs.Record) > 0 {
+		recorder = &fixtureConnector{db: pool, store: &fixtureStore{}}
+		pool = sql.OpenDB(recorder)
+	}
+	workArgs.DB = pool
+
+	workArgs.SourceDBs = openSources(workArgs)
+
+	// 在打开输出文件之前检查表名, 避免导出到一半才因为表不存在而失败
+	if workArgs.Model == "schema" || workArgs.Model == "all" || workArgs.Model == "lint" || (workArgs.Model == "data" && workArgs.Chunk) {
+		checkTablesExist(workArgs)
+	}
+
+	doWork(workArgs)
+
+	if recorder != nil {
+		if err := recorder.store.Save(workArgs.Record); err != nil {
+			errMsg(fmt.Sprintf("can not write record file: %s, err: %v", workArgs.Record, err), 20)
+		}
+		_ = recorder.db.Close()
+	}
+
+	// 关闭数据库连接
+	_ = pool.Close()
+	for _, source := range workArgs.SourceDBs {
+		_ = source.DB.Close()
+	}
+}
+
+func doWork(workArgs workArgsT) {
+	workArgs.Summary = newDumpSummary()
+	if len(workArgs.TargetDB) > 0 && workArgs.DB != nil {
+		workArgs.SourceDatabase = currentDatabase(workArgs)
+	}
+
+	if len(workArgs.Bundle) > 0 {
+		doWorkExportBundle(workArgs)
+		return
+	}
+	if len(workArgs.MydumperDir) > 0 {
+		doWorkExportMydumper(workArgs)
+		return
+	}
+
+	var output = os.Stdout
+	if len(workArgs.Output) > 0 {
+		f, err := os.Create(workArgs.Output)
+		if err != nil {
+			log.Printf("[doWork] can open file: %s, err: %s", workArgs.Output, err.Error())
+			os.Exit(20)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		output = f
+	}
+
+	if workArgs.BOM {
+		_, _ = output.WriteString("\xEF\xBB\xBF")
+	}
+
+	// json/csv 等非 SQL 输出不能带注释头
+	if workArgs.Model != "lineage" && workArgs.Model != "from-dump" && workArgs.Format != "json-map" && workArgs.Format != "yaml" {
+		timeNow := time.Now()
+		comment := fmt.Sprintf("/* export %s by %s at: %d-%02d-%02d %02d:%02d:%02d */\n\n", workArgs.Model, programName,
+			timeNow.Year(), int(timeNow.Month()), timeNow.Day(),
+			timeNow.Hour(), timeNow.Minute(), timeNow.Second())
+		_, err := output.WriteString(comment)
+		if err != nil {
+			log.Printf("[doWork] write err: %v", err)
+		}
+	}
+
+	if workArgs.SourcePosition && workArgs.DB != nil {
+		snapshot, position, err := beginSnapshot(workArgs)
+		if err != nil {
+			log.Printf("[doWork] can not capture source position, err: %v", err)
+			os.Exit(21)
+		}
+		defer func() {
+			_ = snapshot.Close()
+		}()
+		workArgs.DB = snapshot
+		if workArgs.Parallel > 1 {
+			// 快照只在一个连接上, 同一连接不能同时执行多个查询
+			log.Printf("[doWork] source position exports in one snapshot connection, parallel is ignored")
+			workArgs.Parallel = 1
+		}
+		_, _ = output.WriteString(sourcePositionComment(position))
+
+		if len(workArgs.Output) > 0 {
+			if err = writeSourcePosition(workArgs.Output+".position", position); err != nil {
+				log.Printf("[doWork] write source position err: %v", err)
+			}
+		}
+	}
+
+	sqlModel := (workArgs.Model == "schema" || workArgs.Model == "data" || workArgs.Model == "all") && workArgs.Format != "json-map" && workArgs.Format != "yaml"
+	// 页脚写在最后, 导出中途 panic 时不写, 以此判断导出是否完整
+	var completed bool
+	if sqlModel {
+		defer func() {
+			if completed {
+				_, _ = output.WriteString(workArgs.Summary.Footer())
+			}
+		}()
+	}
+	if workArgs.AddCreateDatabase && sqlModel {
+		writeCreateDatabase(workArgs, output)
+	}
+	if sqlModel {
+		writeSessionHeader(workArgs, output)
+	}
+	if workArgs.DisableChecks && sqlModel {
+		writeDisableChecks(workArgs, output, false)
+		defer writeDisableChecks(workArgs, output, true)
+	}
+
+	if workArgs.Model == "schema" {
+		doWorkExportSchema(workArgs, output)
+	} else if workArgs.Model == "all" {
+		doWorkExportAll(workArgs, output)
+	} else if workArgs.Model == "lint" {
+		doWorkLint(workArgs, output)
+	} else if workArgs.Model == "validate" {
+		doWorkValidate(workArgs, output)
+	} else if workArgs.Model == "lineage" {
+		doWorkLineage(workArgs, output)
+	} else if workArgs.Model == "grants" {
+		doWorkExportGrants(workArgs, output)
+	} else if workArgs.Model == "from-dump" {
+		doWorkFromDump(workArgs, output)
+	} else if workArgs.Model == "transform" {
+		doWorkTransform(workArgs, output)
+	} else if workArgs.Format == "json-map" {
+		doWorkExportJSONMap(workArgs, output)
+	} else if workArgs.Format == "yaml" {
+		doWorkExportYAML(workArgs, output)
+	} else if len(workArgs.SourceDBs) > 0 {
+		doWorkExportDataMerge(workArgs, output)
+	} else if workArgs.Chunk {
+		for _, group := range groupShards(workArgs, orderedTables(workArgs)) {
+			if len(group.Logical) > 0 {
+				doWorkExportDataShards(workArgs, output, group)
+				continue
+			}
+
+			taskArgs := workArgs
+			taskArgs.Table = group.Tables[0]
+			if workArgs.ColumnGroupSize > 0 {
+				if columns := exportColumns(taskArgs); len(columns) > workArgs.ColumnGroupSize {
+					doWorkExportDataColumnGroups(taskArgs, output, columns)
+					continue
+				}
+			}
+			doWorkExportData(taskArgs, output)
+		}
+	} else {
+		doWorkExportData(workArgs, output)
+	}
+	// 所有表都已导出, 断点不再需要
+	if len(workArgs.CheckpointFile) > 0 {
+		_ = os.Remove(workArgs.CheckpointFile)
+	}
+
+	if len(workArgs.PrimeScript) > 0 {
+		// 数据导出按实际写入的表(含分表的逻辑表), 只导出表结构时按选中的表
+		tables := workArgs.Summary.Tables()
+		if len(tables) == 0 {
+			tables = orderedTables(workArgs)
+		}
+		writePrimeScript(workArgs, tables)
+	}
+
+	completed = true
+}
+
+func doWorkExportSchema(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkExportSchem] start work")
+
+	tables := orderedTables(workArgs)
+	//logs.Debug("[doWorkExportSchem] tables: %#v\n", tables)
+
+	for _, tbl := range tables {
+		writeCreateTable(withTaskLogger(workArgs, tbl, 0), output, tbl)
+	}
+
+	log.Printf("[doWorkExportSchem] jobs have done.")
+}
+
+// writeCreateTable 写出单表的 DROP TABLE 和建表语句, -if-not-exists 时不删表, 默认去掉 AUTO_INCREMENT 计数
+func writeCreateTable(workArgs workArgsT, output *os.File, tbl string) {
+	if !workArgs.IfNotExists {
+		addIf := fmt.Sprintf("DROP TABLE IF EXISTS %s;\n", quoteTable(workArgs, renameTable(workArgs, tbl)))
+		_, errW := output.WriteString(addIf)
+		if errW != nil {
+			workArgs.Logger.Printf("[writeCreateTable] write err: %v", errW)
+		}
+	}
+
+	createSQL := showCreateTable(workArgs, tbl)
+	if len(createSQL) > 0 {
+		createSQL += ";\n"
+	}
+	// postgres 的建表语句生成时已使用改名后的表名
+	if (len(workArgs.TableRenames) > 0 || len(workArgs.TablePrefix) > 0) && workArgs.DbType == "mysql" {
+		createSQL = renameCreateTable(workArgs, createSQL, tbl)
+	}
+	createSQL = rewriteDatabase(workArgs, createSQL)
+	if workArgs.IfNotExists {
+		createSQL = strings.Replace(createSQL, "CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ", 1)
+	}
+	if workArgs.CharsetMap != nil || workArgs.CollationMap != nil {
+		createSQL = tools.RewriteCharset(createSQL, workArgs.CharsetMap, workArgs.CollationMap)
+	}
+	if workArgs.EngineMap != nil {
+		createSQL = tools.RewriteEngine(createSQL, workArgs.EngineMap)
+	}
+
+	if !workArgs.KeepAutoIncrement {
+		re := regexp.MustCompile(`AUTO_INCREMENT=(\d+) `)
+		createSQL = re.ReplaceAllString(createSQL, "")
+	}
+
+	_, _ = output.WriteString(createSQL)
+	_, _ = output.WriteString("\n")
+}
+
+// doWorkExportAll 按外键依赖顺序逐表写出建表语句和数据, 生成一个可直接导入的完整导出文件
+func doWorkExportAll(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkExportAll] start work")
+
+	tables := orderedTables(workArgs)
+	log.Printf("[doWorkExportAll] tables: %v", tables)
+
+	for _, tbl := range tables {
+		taskArgs := withTaskLogger(workArgs, tbl, 0)
+		taskArgs.Table = tbl
+		if checkpointDone(taskArgs, tbl) {
+			continue
+		}
+
+		writeCreateTable(taskArgs, output, tbl)
+		doWorkExportData(taskArgs, output)
+	}
+
+	log.Printf("[doWorkExportAll] jobs have done.")
+}
+
+// withTaskLogger 为单表任务设置带 [表名#worker] 前缀的日志, 并发导出时日志仍可区分
+func withTaskLogger(workArgs workArgsT, table string, worker int) workArgsT {
+	// go.mod 为 go 1.12, 没有 log.Lmsgprefix, 前缀写在时间之前
+	workArgs.Logger = log.New(os.Stderr, fmt.Sprintf("[%s#%d] ", table, worker), log.LstdFlags)
+
+	return workArgs
+}
+
+// fetchTables 解析 -table 参数, all, glob 和 -table-regex 时对照数据库中的表名展开
+func fetchTables(workArgs workArgsT) []string {
+	if !hasTablePattern(workArgs) {
+		return sortByPriority(workArgs, filterChangedSince(workArgs, strings.Split(workArgs.Table, ",")))
+	}
+
+	var tables []string
+
+	querySQL := "SHOW TABLES"
+	if workArgs.DbType == "postgres" {
+		querySQL = "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name"
+		if len(workArgs.DbSchema) > 0 {
+			schemas := strings.Split(workArgs.DbSchema, ",")
+			var quoted []string
+			for _, schema := range schemas {
+				quoted = append(quoted, "'"+workArgs.QueryEscapeFunc(schema)+"'")
+			}
+			// 多个 schema 中可能有同名的表, 表名带上 schema
+			name := "table_name"
+			if len(schemas) > 1 {
+				name = "table_schema || '.' || table_name"
+			}
+			querySQL = fmt.Sprintf("SELECT %s FROM information_schema.tables WHERE table_schema IN (%s) AND table_type = 'BASE TABLE' ORDER BY table_schema, table_name",
+				name, strings.Join(quoted, ", "))
+		}
+	}
+	log.Printf("[fetchTables] sql: %s", querySQL)
+
+	rows, err := workArgs.DB.Query(querySQL)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		cols, _ := rows.Columns()
+		colsNum := len(cols)
+		refs := make([]interface{}, colsNum)
+		for i := range refs {
+			var ref interface{}
+			refs[i] = &ref
+		}
+		errS := rows.Scan(refs...)
+		if errS != nil {
+			log.Printf("[fetchTables] rows.Scan err: %v", errS)
+		}
+
+		for k := range cols {
+			val := reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
+			tableName := fmt.Sprintf("%s", val)
+			if tableSelected(workArgs, tableName) {
+				tables = append(tables, tableName)
+			}
+		}
+	}
+
+	return sortByPriority(workArgs, filterChangedSince(workArgs, tables))
+}
+
+// showCreateTable 返回 SHOW CREATE TABLE 的建表语句, 不含结尾分号; postgres 由系统表拼出
+func showCreateTable(workArgs workArgsT, tbl string) string {
+	if workArgs.DbType == "postgres" {
+		return postgresCreateTable(workArgs, tbl)
+	}
+
+	querySQL := fmt.Sprintf("SHOW CREATE TABLE %s", quoteTable(workArgs, tbl))
+	workArgs.Logger.Printf("[showCreateTable] sql: %s", querySQL)
+
+	var createSQL = ""
+
+	rows, err := workArgs.DB.Query(querySQL)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		cols, _ := rows.Columns()
+		colsNum := len(cols)
+		refs := make([]interface{}, colsNum)
+		for i := range refs {
+			var ref interface{}
+			refs[i] = &ref
+		}
+		_ = rows.Scan(refs...)
+
+		for k, col := range cols {
+			if col == "Create Table" {
+				val := reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
+				createSQL = fmt.Sprintf("%s", val)
+			}
+		}
+	}
+
+	return createSQL
+}
+
+func doWorkExportData(workArgs workArgsT, output io.Writer) {
+	workArgs = withTaskLogger(workArgs, workArgs.Table, 0)
+	workArgs.Logger.Printf("[doWorkExportData] start work")
+	if checkpointDone(workArgs, workArgs.Table) {
+		workArgs.Logger.Printf("[doWorkExportData] already exported before the checkpoint, skip")
+		return
+	}
+
+	if workArgs.History && len(workArgs.TargetTable) == 0 {
+		workArgs.TargetTable = renameTable(workArgs, workArgs.Table) + "_history"
+	}
+
+	targetColumns, err := loadTargetColumns(workArgs, insertTable(workArgs))
+	if err != nil {
+		workArgs.Logger.Printf("[doWorkExportData] can not load target columns, err: %v", err)
+		os.Exit(31)
+	}
+	workArgs.TargetColumns = targetColumns
+
+	// upsert 的更新列表跳过主键, postgres 的 ON CONFLICT 也需要主键
+	if workArgs.Chunk || workArgs.Upsert || len(workArgs.IncrementalColumn) > 0 || workArgs.InsertMode == "insert-ignore" {
+		workArgs.PrimaryKey = detectPrimaryKey(workArgs, workArgs.Table)
+	}
+	if workArgs.History && len(workArgs.PrimaryKey) > 0 {
+		// 同一主键有多个版本, 加上 row_end 才能唯一确定一行
+		workArgs.PrimaryKey = append(workArgs.PrimaryKey, "row_end")
+	}
+	if workArgs.DbType == "postgres" && (workArgs.Upsert || len(workArgs.IncrementalColumn) > 0) && len(workArgs.PrimaryKey) == 0 {
+		// 没有冲突目标时 ON CONFLICT 只能 DO NOTHING, 已存在的行不会更新
+		workArgs.Logger.Printf("[doWorkExportData] no primary key, upsert falls back to ON CONFLICT DO NOTHING")
+		workArgs.Summary.Warn()
+	}
+
+	if len(workArgs.IncrementalColumn) > 0 {
+		workArgs = prepareIncremental(workArgs)
+	}
+
+	// 分表时由调用方为逻辑表创建, 各分表共用同一个 -limit
+	if workArgs.Sampler == nil && (workArgs.Limit > 0 || len(workArgs.Sample) > 0) {
+		workArgs.Sampler, _ = newRowSampler(workArgs.Limit, workArgs.Sample)
+	}
+	if workArgs.Chunk {
+		workArgs.Sampler.pushDown(workArgs)
+	}
+	// 分表和多分片合并时由调用方为逻辑表创建, 各分片共用
+	if workArgs.Dedupe == nil {
+		workArgs.Dedupe = newTableDedupe(workArgs)
+	}
+
+	if workArgs.ChunkAnomalyFactor > 0 {
+		workArgs.ChunkTimer = &chunkTimer{}
+	}
+
+	workArgs.Checkpoint, err = loadCheckpoint(workArgs)
+	if err != nil {
+		workArgs.Logger.Printf("[doWorkExportData] read checkpoint err: %v", err)
+		os.Exit(34)
+	}
+
+	workArgs.Summary.AddRows(insertTable(workArgs), 0)
+
+	if workArgs.Checkpoint == nil && !workArgs.SkipClear {
+		writeClearTable(workArgs, output)
+	}
+
+	if len(workArgs.OutfileDir) > 0 {
+		doWorkExportDataOutfile(workArgs, output)
+	} else if workArgs.Chunk && isSystemObject(workArgs.Table) {
+		// 系统视图没有主键, 分页之间内容会变化, 用一次查询取得快照
+		querySQL := fmt.Sprintf("%s FROM %s%s", selectFields(workArgs), selectFrom(workArgs), dataWhere(workArgs))
+		workArgs.Logger.Printf("[doWorkExportData] system object, export in one query: %s", querySQL)
+		if result := doWorkExportDataChunk(workArgs, output, querySQL, nil, 0); result.Err != nil {
+			stopOnChunkError(workArgs, output, nil, result)
+		}
+	} else if workArgs.Chunk {
+		workArgs.Logger.Printf("[doWorkExportData] use chunk")
+
+		pk := workArgs.PrimaryKey
+		orderBy, ok := workArgs.OrderBy[workArgs.Table]
+		if workArgs.ClusterOrder {
+			// 源表单列主键的 keyset 分页本身按主键有序, 目标主键不同时才需要按目标主键排序
+			if key := clusterKey(workArgs); len(key) > 0 && !(len(pk) == 1 && sameColumns(key, pk)) {
+				workArgs.Logger.Printf("[doWorkExportData] cluster order: %v", key)
+				orderBy, ok = key, true
+			}
+		}
+		if ok {
+			// 业务列可能有重复, 追加主键保证分页键唯一; 有 NULL 的列不能用 (a, b) > (x, y) 比较, 只能用 offset 分页
+			for _, col := range pk {
+				if !tools.InArray(col, orderBy) {
+					orderBy = append(orderBy, col)
+				}
+			}
+			if nullable := nullableColumns(workArgs, workArgs.Table, orderBy); len(pk) > 0 && len(nullable) == 0 {
+				workArgs.Logger.Printf("[doWorkExportData] order by %v, use keyset", orderBy)
+				doWorkExportDataByKeyset(workArgs, output, orderBy, "")
+			} else {
+				workArgs.Logger.Printf("[doWorkExportData] order by %v, no primary key or nullable columns %v, use offset", orderBy, nullable)
+				doWorkExportDataByOffset(workArgs, output, orderBy)
+			}
+		} else if len(pk) == 1 && workArgs.Parallel > 1 {
+			doWorkExportDataParallel(workArgs, output, pk[0])
+		} else if len(pk) > 0 {
+			doWorkExportDataByKeyset(workArgs, output, pk, "")
+		} else {
+			workArgs.Logger.Printf("[doWorkExportData] no primary key, fallback to offset")
+			workArgs.Summary.Warn()
+			doWorkExportDataByOffset(workArgs, output, pk)
+		}
+	} else {
+		querySQL, err := readInputSQL(workArgs.Input)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stdout, "cat not read sql file:%s, err: %s\n", workArgs.Input, err.Error())
+			os.Exit(30)
+		}
+
+		if result := doWorkExportDataUseChunk(workArgs, output, querySQL, nil); result.Err != nil {
+			stopOnChunkError(workArgs, output, nil, result)
+		}
+	}
+
+	// 分表和多分片合并时各自的序列互相冲突, 不输出
+	if workArgs.DbType == "postgres" && workArgs.Chunk && len(workArgs.TargetTable) == 0 && len(workArgs.SourceTag) == 0 && !isSystemObject(workArgs.Table) {
+		writeTableSequences(workArgs, output)
+	}
+
+	markCheckpointDone(workArgs)
+
+	if workArgs.Watermark != nil && len(workArgs.StateFile) > 0 {
+		if value, ok := workArgs.Watermark.Value(); ok {
+			if err = saveIncrementalState(workArgs.StateFile, workArgs.Table, value); err != nil {
+				workArgs.Logger.Printf("[doWorkExportData] save state file err: %v", err)
+				os.Exit(33)
+			}
+			workArgs.Logger.Printf("[doWorkExportData] high watermark: %s", value)
+		}
+	}
+
+	workArgs.Logger.Printf("[doWorkExportData] jobs have done.")
+}
+
+// prepareIncremental 确定增量导出的起始水位, 并开启 upsert 输出
+func prepareIncremental(workArgs workArgsT) workArgsT {
+	if len(workArgs.Since) == 0 && len(workArgs.StateFile) > 0 {
+		state, err := loadIncrementalState(workArgs.StateFile)
+		if err != nil {
+			workArgs.Logger.Printf("[prepareIncremental] read state file err: %v", err)
+			os.Exit(33)
+		}
+		workArgs.Since = state[workArgs.Table]
+	}
+
+	workArgs.Watermark = &watermark{}
+	workArgs.Upsert = true
+	workArgs.Logger.Printf("[prepareIncremental] %s > %q", workArgs.IncrementalColumn, workArgs.Since)
+
+	return workArgs
+}
+
+// dataConditions 返回数据查询的过滤条件
+func dataConditions(workArgs workArgsT) []string {
+	var conds []string
+
+	if len(workArgs.Where) > 0 {
+		conds = append(conds, "("+workArgs.Where+")")
+	}
+
+	if len(workArgs.IncrementalColumn) > 0 && len(workArgs.Since) > 0 {
+		conds = append(conds, fmt.Sprintf("%s > '%s'", quoteIdent(workArgs, workArgs.IncrementalColumn), workArgs.QueryEscapeFunc(workArgs.Since)))
+	}
+
+	if len(workArgs.AsOf) > 0 && len(workArgs.ValidityColumns) > 0 {
+		validity := strings.Split(workArgs.ValidityColumns, ",")
+		from, to := quoteIdent(workArgs, validity[0]), quoteIdent(workArgs, validity[1])
+		asOf := workArgs.QueryEscapeFunc(workArgs.AsOf)
+		conds = append(conds, fmt.Sprintf("%s <= '%s' AND (%s IS NULL OR %s > '%s')", from, asOf, to, to, asOf))
+	}
+
+	return conds
+}
+
+// dataWhere 把过滤条件和额外条件拼成 WHERE 子句, 没有条件时返回空
+func dataWhere(workArgs workArgsT, extra ...string) string {
+	conds := dataConditions(workArgs)
+	extra = append(extra, workArgs.Sampler.condition())
+	for _, cond := range extra {
+		if len(cond) > 0 {
+			conds = append(conds, cond)
+		}
+	}
+
+	if len(conds) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// doWorkExportDataByKeyset 按分页键分页: WHERE (k1, k2) > (last1, last2) ORDER BY k1, k2 LIMIT n, 避免大表 OFFSET 越翻越慢.
+// 分页键为主键, 或 -order-by 的列加上主键, 各列都不能为 NULL; rangeCond 非空时只导出满足该条件的主键区间.
+func doWorkExportDataByKeyset(workArgs workArgsT, output io.Writer, keys []string, rangeCond string) {
+	workArgs.Logger.Printf("[doWorkExportDataByKeyset] keys: %v", keys)
+
+	var lastKey []string
+	var start int64
+	if cp := workArgs.Checkpoint; cp != nil && cp.Key == strings.Join(keys, ",") && len(cp.LastKey) == len(keys) && len(rangeCond) == 0 {
+		start, lastKey = cp.Chunk, cp.LastKey
+		workArgs.Logger.Printf("[doWorkExportDataByKeyset] resume from chunk %d, %v > %v", start, keys, lastKey)
+	}
+
+	for i := start; ; i++ {
+		if len(rangeCond) == 0 {
+			stopAtDeadline(workArgs, output, checkpointT{Table: workArgs.Table, Key: strings.Join(keys, ","), LastKey: lastKey, Chunk: i})
+		}
+
+		// 上一块最后一行的分页键作为参数绑定, 不拼进 SQL
+		var keyCond string
+		var keyArgs []interface{}
+		if i > 0 {
+			binds := make([]string, len(keys))
+			for k := range keys {
+				binds[k] = bindVar(workArgs, k+1)
+				keyArgs = append(keyArgs, lastKey[k])
+			}
+			if len(keys) == 1 {
+				keyCond = fmt.Sprintf("%s > %s", quoteIdent(workArgs, keys[0]), binds[0])
+			} else {
+				keyCond = fmt.Sprintf("(%s) > (%s)", quoteIdents(workArgs, keys), strings.Join(binds, ", "))
+			}
+		}
+		where := dataWhere(workArgs, rangeCond, keyCond)
+		querySQL := fmt.Sprintf(`%s FROM %s%s ORDER BY %s LIMIT %d`, selectFields(workArgs), selectFrom(workArgs), where, quoteIdents(workArgs, keys), chunkSize)
+		workArgs.Logger.Printf("[doWorkExportDataByKeyset] sql: %s", querySQL)
+
+		result := doWorkExportDataChunk(workArgs, output, querySQL, keys, i, keyArgs...)
+		if result.Err != nil {
+			var cp *checkpointT
+			if len(rangeCond) == 0 {
+				cp = &checkpointT{Table: workArgs.Table, Key: strings.Join(keys, ","), LastKey: lastKey, Chunk: i}
+			}
+			stopOnChunkError(workArgs, output, cp, result)
+		}
+		if result.Scanned < chunkSize || workArgs.Sampler.Done() {
+			break
+		}
+		lastKey = result.LastKey
+	}
+}
+
+// bindVar 返回第 n 个绑定参数的占位符, mysql 为 ?, postgres 为 $n
+func bindVar(workArgs workArgsT, n int) string {
+	if workArgs.DbType == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+
+	return "?"
+}
+
+// writeClearTable 按 -truncate-before-insert/-delete-before-insert 在表数据之前清空目标表, 重复导入时结果一致;
+// DELETE 带上 -where 条件, 只清除本次导出的范围.
+func writeClearTable(workArgs workArgsT, output io.Writer) {
+	// 清除的范围不受抽样影响
+	workArgs.Sampler = nil
+	tbl := quoteTable(workArgs, insertTable(workArgs))
+
+	var clearSQL string
+	if workArgs.TruncateBeforeInsert {
+		clearSQL = fmt.Sprintf("TRUNCATE TABLE %s;\n\n", tbl)
+	} else if workArgs.DeleteBeforeInsert {
+		clearSQL = fmt.Sprintf("DELETE FROM %s%s;\n\n", tbl, dataWhere(workArgs))
+	} else {
+		return
+	}
+
+	_, _ = io.WriteString(output, clearSQL)
+}
+
+// insertTable 返回 INSERT 语句的目标表名, 系统视图导入到当前库中以 schema_表名 命名的快照表;
+// TargetTable 由调用方设置, 已经按 -rename-table/-table-prefix 处理过.
+func insertTable(workArgs workArgsT) string {
+	if len(workArgs.TargetTable) > 0 {
+		return workArgs.TargetTable
+	}
+	if isSystemObject(workArgs.Table) {
+		return renameTable(workArgs, strings.Replace(workArgs.Table, ".", "_", 1))
+	}
+
+	return renameTable(workArgs, workArgs.Table)
+}
+
+// renameTable 返回输出语句中使用的表名: 先按 -rename-table 替换, 再加 -table-prefix; schema.table 形式的名称只给表名加前缀
+func renameTable(workArgs workArgsT, name string) string {
+	if renamed, ok := workArgs.TableRenames[strings.ToLower(name)]; ok {
+		name = renamed
+	}
+
+	dot := strings.LastIndex(name, ".") + 1
+	return name[:dot] + workArgs.TablePrefix + name[dot:]
+}
+
+// referencesRe 建表语句中外键引用的表, 其他库中的表带库名
+var referencesRe = regexp.MustCompile("REFERENCES (`(?:[^`]|``)+`\\.)?`((?:[^`]|``)+)`")
+
+// constraintRe 建表语句中的约束名, 外键和 CHECK 约束名在库内唯一
+var constraintRe = regexp.MustCompile("CONSTRAINT `((?:[^`]|``)+)`")
+
+// renameCreateTable 替换 SHOW CREATE TABLE 结果中的表名, 约束名和外键引用的同库表名, 外键指向的表同样会被改名导出
+func renameCreateTable(workArgs workArgsT, createSQL string, tbl string) string {
+	createSQL = strings.Replace(createSQL, "CREATE TABLE "+quoteTable(workArgs, tbl), "CREATE TABLE "+quoteTable(workArgs, renameTable(workArgs, tbl)), 1)
+
+	createSQL = constraintRe.ReplaceAllStringFunc(createSQL, func(match string) string {
+		name := strings.Replace(constraintRe.FindStringSubmatch(match)[1], "``", "`", -1)
+		return "CONSTRAINT " + quoteIdent(workArgs, renameConstraint(workArgs, tbl, name))
+	})
+
+	return referencesRe.ReplaceAllStringFunc(createSQL, func(match string) string {
+		m := referencesRe.FindStringSubmatch(match)
+		if len(m[1]) > 0 {
+			return match
+		}
+		return "REFERENCES " + quoteTable(workArgs, renameTable(workArgs, strings.Replace(m[2], "``", "`", -1)))
+	})
+}
+
+// renameConstraint 改名导出时的约束名和索引名: 名称中包含原表名时替换为 -rename-table 的新表名, 不包含时以新表名开头,
+// 再加 -table-prefix, 避免与同一个库中原表的约束重名, 如 fk_t1_user -> staging_fk_users_user
+func renameConstraint(workArgs workArgsT, tbl string, name string) string {
+	if renamed, ok := workArgs.TableRenames[strings.ToLower(tbl)]; ok {
+		if strings.Contains(name, tbl) {
+			name = strings.Replace(name, tbl, renamed, -1)
+		} else {
+			name = renamed + "_" + name
+		}
+	}
+
+	return workArgs.TablePrefix + name
+}
+
+// insertVerb 按 -insert-mode 返回数据语句的动词, postgres 的 insert-ignore 由 ON CONFLICT 子句实现
+func insertVerb(workArgs workArgsT) string {
+	if workArgs.DbType == "postgres" {
+		return "INSERT"
+	}
+
+	switch workArgs.InsertMode {
+	case "insert-ignore":
+		return "INSERT IGNORE"
+	case "replace":
+		return "REPLACE"
+	default:
+		return "INSERT"
+	}
+}
+
+// selectFrom 返回数据查询的 FROM 部分, -table-query 指定了自定义查询时作为以表名为别名的子查询;
+// -as-of 和 -history 时查询系统版本表的指定时间点或全部版本.
+func selectFrom(workArgs workArgsT) string {
+	if query, ok := workArgs.TableSQL[workArgs.Table]; ok {
+		return fmt.Sprintf("(%s) AS %s", query, quoteIdent(workArgs, workArgs.Table))
+	}
+
+	// 系统版本表的 row_start/row_end 是隐藏列, SELECT * 不包含, 需要显式查询
+	if workArgs.History {
+		return fmt.Sprintf("(SELECT *, ROW_START AS row_start, ROW_END AS row_end FROM %s FOR SYSTEM_TIME ALL) AS %s",
+			quoteTable(workArgs, workArgs.Table), quoteIdent(workArgs, workArgs.Table))
+	}
+	if len(workArgs.AsOf) > 0 && len(workArgs.ValidityColumns) == 0 {
+		return fmt.Sprintf("%s FOR SYSTEM_TIME AS OF TIMESTAMP '%s'", quoteTable(workArgs, workArgs.Table), workArgs.QueryEscapeFunc(workArgs.AsOf))
+	}
+
+	return quoteTable(workArgs, workArgs.Table) + workArgs.Sampler.tableSample()
+}
+
+// selectFields 返回数据查询的 SELECT 部分
+func selectFields(workArgs workArgsT) string {
+	if workArgs.Distinct {
+		return "SELECT DISTINCT *"
+	}
+
+	return "SELECT *"
+}
+
+// doWorkExportDataByOffset 没有可用主键或指定了排序列时使用 LIMIT/OFFSET 分页
+func doWorkExportDataByOffset(workArgs workArgsT, output io.Writer, orderBy []string) {
+	where := dataWhere(workArgs)
+
+	var total int64
+	totalSQL := fmt.Sprintf(`SELECT COUNT(*) AS total FROM %s%s`, selectFrom(workArgs), where)
+	if workArgs.Distinct {
+		totalSQL = fmt.Sprintf(`SELECT COUNT(*) AS total FROM (SELECT DISTINCT * FROM %s%s) AS t`, selectFrom(workArgs), where)
+	}
+	row := workArgs.DB.QueryRow(totalSQL)
+	err := row.Scan(&total)
+	if err != nil {
+		panic(err)
+	}
+
+	var pageTotal int64 = int64(math.Ceil(float64(total) / float64(chunkSize)))
+	workArgs.Logger.Printf("[doWorkExportDataByOffset] pageTotal: %d", pageTotal)
+
+	var order string
+	if len(orderBy) > 0 {
+		order = " ORDER BY " + quoteIdents(workArgs, orderBy)
+	}
+
+	var start int64
+	if cp := workArgs.Checkpoint; cp != nil && len(cp.Key) == 0 {
+		start = cp.Chunk
+		workArgs.Logger.Printf("[doWorkExportDataByOffset] resume from chunk %d", start)
+	}
+
+	for i := start; i < pageTotal && !workArgs.Sampler.Done(); i++ {
+		stopAtDeadline(workArgs, output, checkpointT{Table: workArgs.Table, Chunk: i})
+
+		offset := i * chunkSize
+		querySQL := fmt.Sprintf(`%s FROM %s%s%s LIMIT %d OFFSET %d`, selectFields(workArgs), selectFrom(workArgs), where, order, chunkSize, offset)
+		workArgs.Logger.Printf("[doWorkExportDataByOffset] sql: %s", querySQL)
+		if result := doWorkExportDataChunk(workArgs, output, querySQL, nil, i); result.Err != nil {
+			stopOnChunkError(workArgs, output, &checkpointT{Table: workArgs.Table, Chunk: i}, result)
+		}
+	}
+}
+
+// doWorkExportDataChunk 导出一个分块, 先缓存分块内容, 空分块不输出; 开启 -chunk-checksum 时在分块前写出行数和 crc32
+func doWorkExportDataChunk(workArgs workArgsT, output io.Writer, querySQL string, keyColumns []string, chunk int64, queryArgs ...interface{}) chunkResult {
+	var buf bytes.Buffer
+	start := time.Now()
+	result := doWorkExportDataUseChunk(workArgs, &buf, querySQL, keyColumns, queryArgs...)
+	cost := time.Since(start)
+	if median, slow := workArgs.ChunkTimer.Observe(cost, workArgs.ChunkAnomalyFactor); slow {
+		reportChunkAnomaly(workArgs, chunk, cost, median)
+	}
+	if result.Rows == 0 || result.Err != nil {
+		return result
+	}
+
+	if workArgs.ChunkChecksum {
+		_, _ = io.WriteString(output, fmt.Sprintf("/* chunk %d: rows=%d crc32=%08x */\n", chunk, result.Rows, crc32.ChecksumIEEE(buf.Bytes())))
+	} else {
+		_, _ = io.WriteString(output, fmt.Sprintf("/** chunk: %d */\n", chunk))
+	}
+	if _, err := workArgs.Chaos.Write(output, buf.Bytes()); err != nil {
+		workArgs.Logger.Printf("[doWorkExportDataChunk] write err: %v", err)
+		result.Err, result.ErrCode = err, 20
+		return result
+	}
+	if boundary, ok := output.(chunkBoundary); ok {
+		boundary.ChunkDone()
+	}
+
+	return result
+}
+
+// doWorkExportDataUseChunk 执行查询并写出 INSERT 语句, 返回导出的行数和 keyColumns 各列最后一行的值; queryArgs 为查询的绑定参数; 注入的查询故障通过 Err 返回
+func doWorkExportDataUseChunk(workArgs workArgsT, output io.Writer, querySQL string, keyColumns []string, queryArgs ...interface{}) chunkResult {
+	workArgs.Logger.Printf("[doWorkExportDataUseChunk] chunk jobs start.")
+	workArgs.Logger.Printf("sql: %s, args: %v", querySQL, queryArgs)
+
+	counter := &countingWriter{w: output}
+	output = counter
+
+	if err := workArgs.Chaos.BeforeQuery(workArgs); err != nil {
+		workArgs.Logger.Printf("[doWorkExportDataUseChunk] query err: %v", err)
+		return chunkResult{Err: err, ErrCode: 30}
+	}
+
+	rows, err := workArgs.DB.Query(querySQL, queryArgs...)
+	if err != nil {
+		panic(err)
+	}
+
+	var fieldBox []string
+	var skipFieldBox = make(map[string]bool)
+	expSkipField := strings.Split(workArgs.SkipField, ",")
+	if len(expSkipField) > 0 {
+		for _, field := range expSkipField {
+			skipFieldBox[field] = true
+		}
+	}
+	var onlyFields []string
+	if len(workArgs.OnlyField) > 0 {
+		onlyFields = strings.Split(workArgs.OnlyField, ",")
+	}
+
+	var columns []string
+	var colTypes []string
+	var fieldIdx []int
+	var backfillBox []string
+	var lineage []string
+	var masked map[int]maskRule
+	var colsNum int
+	var i int
+	var stmtRows, stmtBytes int // 当前 INSERT 语句的行数和字节数
+	var result chunkResult
+	for rows.Next() {
+		if workArgs.Sampler.Done() {
+			break
+		}
+
+		if columns == nil {
+			columns, _ = rows.Columns()
+			types, _ := rows.ColumnTypes()
+			colTypes = make([]string, len(columns))
+			for k, ct := range types {
+				colTypes[k] = ct.DatabaseTypeName()
+			}
+			for k, col := range columns {
+				if skipFieldBox[col] || (onlyFields != nil && !tools.InArray(col, onlyFields)) {
+					continue
+				}
+				fieldBox = append(fieldBox, col)
+				fieldIdx = append(fieldIdx, k)
+			}
+			colsNum = len(columns)
+			if len(fieldIdx) == 0 {
+				errMsg("no field left to export, check skip-field and only-field", 13)
+			}
+
+			for _, col := range workArgs.TargetColumns {
+				if !tools.InArray(col, columns) {
+					backfillBox = append(backfillBox, col)
+				}
+			}
+			fieldBox = append(fieldBox, backfillBox...)
+			if len(workArgs.SourceTagColumn) > 0 {
+				fieldBox = append(fieldBox, workArgs.SourceTagColumn)
+			}
+			lineage = columnLineage(workArgs, querySQL, fieldBox, backfillBox)
+			masked = workArgs.Masker.Columns(workArgs.Table, columns)
+			if missing := workArgs.Dedupe.Missing(columns); len(missing) > 0 {
+				errMsg(fmt.Sprintf("dedupe-on column %s not found in table %s", strings.Join(missing, ","), workArgs.Table), 13)
+			}
+		}
+
+		//fmt.Println("fieldBox:", fieldBox)
+		//fmt.Println("skipFieldBox:", skipFieldBox)
+
+		refs := make([]interface{}, colsNum)
+		for i := range refs {
+			var ref interface{}
+			refs[i] = &ref
+		}
+		_ = rows.Scan(refs...)
+		result.Scanned++
+
+		vals := make([]interface{}, colsNum)
+		record := make(map[string]interface{}, colsNum)
+		for k, col := range columns {
+			vals[k] = reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
+			record[col] = vals[k]
+		}
+		workArgs.Throttle.Wait(1, rowSize(vals))
+		if len(keyColumns) > 0 {
+			result.LastKey = make([]string, len(keyColumns))
+			for k, col := range keyColumns {
+				result.LastKey[k] = keyValue(workArgs, record[col])
+			}
+		}
+		if workArgs.Watermark != nil && record[workArgs.IncrementalColumn] != nil {
+			workArgs.Watermark.Update(keyValue(workArgs, record[workArgs.IncrementalColumn]))
+		}
+
+		if workArgs.Dedupe != nil && workArgs.Dedupe.Seen(record) {
+			continue
+		}
+		if !workArgs.Sampler.Keep() {
+			continue
+		}
+		if len(masked) > 0 {
+			workArgs.Masker.Apply(workArgs, masked, columns, colTypes, vals)
+		}
+
+		if workArgs.Format == "copy" {
+			if i == 0 {
+				_, _ = io.WriteString(output, copyHeader(workArgs, fieldBox))
+			}
+			_, _ = io.WriteString(output, copyRow(workArgs, columns, colTypes, fieldIdx, vals, record))
+			i++
+			continue
+		}
+
+		var values []string
+		for _, k := range fieldIdx {
+			if vals[k] == nil {
+				values = append(values, "NULL")
+				continue
+			}
+			if b, ok := vals[k].([]byte); ok && workArgs.DbType == "mysql" && colTypes[k] == "GEOMETRY" {
+				if geom, ok := mysqlGeometryLiteral(b); ok {
+					values = append(values, geom)
+					continue
+				}
+			}
+			ve := renderValue(workArgs, vals[k], colTypes[k])
+			if workArgs.ValidateUTF8 {
+				ve = validateUTF8(workArgs, ve, columns[k], colTypes[k], record)
+			}
+			values = append(values, sqlLiteral(workArgs, ve, colTypes[k]))
+		}
+		for _, col := range backfillBox {
+			values = append(values, backfillValue(workArgs, col))
+		}
+		if len(workArgs.SourceTagColumn) > 0 {
+			values = append(values, fmt.Sprintf(`'%s'`, workArgs.EscapeFunc(workArgs.SourceTag)))
+		}
+		vSql := fmt.Sprintf("(%s)", strings.Join(values, ", "))
+
+		// 超过 -max-statement-bytes 时先结束当前语句, 单行超过上限时单独成句
+		if stmtRows > 0 && workArgs.MaxStatementBytes > 0 && stmtBytes+len(",\n")+len(vSql)+len(insertTail(workArgs, fieldBox)) > workArgs.MaxStatementBytes {
+			_, _ = io.WriteString(output, insertTail(workArgs, fieldBox)+"\n")
+			stmtRows = 0
+		}
+
+		if stmtRows == 0 {
+			initSql := fmt.Sprintf("%s INTO %s (%s) VALUES\n", insertVerb(workArgs), quoteTable(workArgs, insertTable(workArgs)),
+				quoteIdents(workArgs, fieldBox))
+			if lineage != nil {
+				// 每列一行, 行尾注释写出来源
+				var sb strings.Builder
+				for k, field := range fieldBox {
+					sep := ","
+					if k == len(fieldBox)-1 {
+						sep = ""
+					}
+					sb.WriteString(fmt.Sprintf("  %s%s -- %s\n", quoteIdent(workArgs, field), sep, lineage[k]))
+				}
+				initSql = fmt.Sprintf("%s INTO %s (\n%s) VALUES\n", insertVerb(workArgs), quoteTable(workArgs, insertTable(workArgs)), sb.String())
+			}
+			if workArgs.RowsPerInsert == 1 {
+				// 单行语句写在一行内, 便于 diff
+				initSql = strings.TrimSuffix(initSql, "\n") + " "
+			}
+			_, _ = io.WriteString(output, initSql)
+			stmtBytes = len(initSql)
+		} else {
+			_, _ = io.WriteString(output, ",\n")
+			stmtBytes += len(",\n")
+		}
+
+		_, _ = io.WriteString(output, vSql)
+		stmtBytes += len(vSql)
+		stmtRows++
+		i++
+
+		if workArgs.RowsPerInsert > 0 && stmtRows >= workArgs.RowsPerInsert {
+			_, _ = io.WriteString(output, insertTail(workArgs, fieldBox)+"\n")
+			stmtRows = 0
+		}
+	}
+
+	_ = rows.Close()
+
+	if i > 0 && workArgs.Format == "copy" {
+		_, _ = io.WriteString(output, "\\.\n\n")
+	} else if stmtRows > 0 {
+		_, _ = io.WriteString(output, insertTail(workArgs, fieldBox)+"\n\n")
+	} else if i > 0 {
+		_, _ = io.WriteString(output, "\n")
+	}
+
+	workArgs.Logger.Printf("[doWorkExportDataUseChunk] chunk jobs have done.")
+
+	result.Rows = int64(i)
+	workArgs.Summary.AddRows(insertTable(workArgs), result.Rows)
+	workArgs.Summary.AddBytes(counter.n)
+	workArgs.Summary.CheckLimits(workArgs)
+	return result
+}
+
+// insertTail 返回 INSERT 语句的结尾, 包括冲突处理子句和分号
+func insertTail(workArgs workArgsT, fields []string) string {
+	// postgres 没有 INSERT IGNORE, 用 ON CONFLICT DO NOTHING 代替
+	if workArgs.Upsert || (workArgs.DbType == "postgres" && workArgs.InsertMode == "insert-ignore") {
+		return upsertClause(workArgs, fields) + ";"
+	}
+
+	return ";"
+}
+
+// upsertClause 生成 INSERT 语句的冲突更新子句, mysql 为 ON DUPLICATE KEY UPDATE, postgres 为 ON CONFLICT (pk) DO UPDATE
+func upsertClause(workArgs workArgsT, fields []string) string {
+	var sets []string
+	for _, field := range fields {
+		if tools.InArray(field, workArgs.PrimaryKey) {
+			continue
+		}
+		col := quoteIdent(workArgs, field)
+		if workArgs.DbType == "postgres" {
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+		} else {
+			sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", col, col))
+		}
+	}
+
+	if workArgs.DbType == "postgres" {
+		if len(workArgs.PrimaryKey) == 0 {
+			return "\nON CONFLICT DO NOTHING"
+		}
+		conflict := quoteIdents(workArgs, workArgs.PrimaryKey)
+		if len(sets) == 0 || workArgs.InsertMode == "insert-ignore" {
+			return fmt.Sprintf("\nON CONFLICT (%s) DO NOTHING", conflict)
+		}
+		return fmt.Sprintf("\nON CONFLICT (%s) DO UPDATE SET %s", conflict, strings.Join(sets, ", "))
+	}
+
+	if len(sets) == 0 {
+		// 只有主键列时用一个无副作用的赋值, 保持语句合法
+		col := quoteIdent(workArgs, fields[0])
+		sets = append(sets, fmt.Sprintf("%s = %s", col, col))
+	}
+
+	return "\nON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// rawValue 把扫描得到的值转换为字符串
+func rawValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999Z07:00")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// keyValue 用于拼接查询条件的值; mysql 开启 parseTime 后时间按会话时区的本地时间输出, 低版本不认识带偏移的时间
+func keyValue(workArgs workArgsT, val interface{}) string {
+	if v, ok := val.(time.Time); ok && workArgs.DbType == "mysql" {
+		return v.Format(mysqlDatetimeLayout)
+	}
 
-	log.Printf("[doWorkExportDataUseChunk] chunk jobs have done.")
+	return rawValue(val)
 }
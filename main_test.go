@@ -0,0 +1,740 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// replayArgs 返回从内存中的录制结果回放查询的参数, 与 -replay 使用同一个驱动
+func replayArgs(dbType string, queries ...fixtureQuery) workArgsT {
+	store := &fixtureStore{replay: make(map[string][]fixtureQuery)}
+	for _, q := range queries {
+		key := fixtureKey(q.Query, q.Args)
+		store.replay[key] = append(store.replay[key], q)
+	}
+
+	args := workArgsT{
+		DbType:          dbType,
+		Table:           "t1",
+		DB:              sql.OpenDB(&fixtureConnector{store: store}),
+		DateFormat:      mysqlDateLayout,
+		TimestampFormat: mysqlDatetimeLayout,
+		InsertMode:      "insert",
+		Summary:         newDumpSummary(),
+		Chaos:           &chaosT{},
+		Logger:          log.New(ioutil.Discard, "", 0),
+	}
+	if dbType == "postgres" {
+		args.EscapeFunc, args.QueryEscapeFunc = tools.PgEscape, tools.PgEscape
+	} else {
+		args.EscapeFunc, args.QueryEscapeFunc = tools.AddSlashes, tools.AddSlashes
+	}
+
+	return args
+}
+
+// exportRows 回放一次查询并返回导出的数据语句
+func exportRows(t *testing.T, workArgs workArgsT, q fixtureQuery) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	doWorkExportDataUseChunk(workArgs, &buf, q.Query, nil)
+	_ = workArgs.DB.(*sql.DB).Close()
+
+	return buf.String()
+}
+
+func TestExportNullValues(t *testing.T) {
+	types := map[string][]string{
+		"mysql": {"TINYINT", "INT", "BIGINT", "UNSIGNED BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "BIT", "YEAR", "CHAR", "VARCHAR",
+			"TEXT", "BLOB", "VARBINARY", "ENUM", "SET", "DATE", "DATETIME", "TIMESTAMP", "TIME", "JSON", "GEOMETRY"},
+		"postgres": {"INT2", "INT4", "INT8", "NUMERIC", "FLOAT4", "FLOAT8", "BOOL", "VARCHAR", "TEXT", "BYTEA", "UUID", "DATE",
+			"TIMESTAMP", "TIMESTAMPTZ", "INTERVAL", "JSON", "JSONB", "INET", "_INT4"},
+	}
+
+	for dbType, colTypes := range types {
+		q := fixtureQuery{Query: "SELECT * FROM t1", Types: colTypes}
+		var nulls []fixtureValue
+		var expected []string
+		for k := range colTypes {
+			q.Columns = append(q.Columns, "c"+string(rune('a'+k)))
+			nulls = append(nulls, fixtureValue{Type: "null"})
+			expected = append(expected, "NULL")
+		}
+		q.Rows = [][]fixtureValue{nulls}
+
+		out := exportRows(t, replayArgs(dbType, q), q)
+		row := "(" + strings.Join(expected, ", ") + ")"
+		if !strings.Contains(out, row+";") {
+			t.Errorf("%s: expected row %s, got:\n%s", dbType, row, out)
+		}
+		if strings.Contains(out, "<nil>") || strings.Contains(out, "''") {
+			t.Errorf("%s: NULL exported as a string:\n%s", dbType, out)
+		}
+	}
+}
+
+func TestExportNullMixedWithValues(t *testing.T) {
+	q := fixtureQuery{
+		Query:   "SELECT * FROM t1",
+		Columns: []string{"id", "name", "score", "created"},
+		Types:   []string{"INT", "VARCHAR", "DECIMAL", "DATETIME"},
+		Rows: [][]fixtureValue{
+			{{Type: "int", Value: "1"}, {Type: "null"}, {Type: "bytes", Value: "1.50"}, {Type: "null"}},
+			{{Type: "int", Value: "2"}, {Type: "bytes", Value: ""}, {Type: "null"}, {Type: "bytes", Value: "2024-01-02 03:04:05"}},
+		},
+	}
+
+	out := exportRows(t, replayArgs("mysql", q), q)
+	for _, row := range []string{"(1, NULL, 1.50, NULL)", "(2, '', NULL, '2024-01-02 03:04:05')"} {
+		if !strings.Contains(out, row) {
+			t.Errorf("expected row %s, got:\n%s", row, out)
+		}
+	}
+}
+
+func TestExportNullCopyFormat(t *testing.T) {
+	q := fixtureQuery{
+		Query:   "SELECT * FROM t1",
+		Columns: []string{"id", "name", "data"},
+		Types:   []string{"INT4", "TEXT", "BYTEA"},
+		Rows:    [][]fixtureValue{{{Type: "int", Value: "1"}, {Type: "null"}, {Type: "null"}}},
+	}
+
+	workArgs := replayArgs("postgres", q)
+	workArgs.Format = "copy"
+	out := exportRows(t, workArgs, q)
+	if !strings.Contains(out, "1\t\\N\t\\N\n") {
+		t.Errorf("expected \\N for NULL in COPY, got:\n%s", out)
+	}
+}
+
+func TestExportControlCharacters(t *testing.T) {
+	values := []string{"line1\nline2", "cr\r\nlf", "nul\x00byte", "ctrl\x1az", `back\slash`, "quote'\"", "tab\tkept"}
+	q := fixtureQuery{Query: "SELECT * FROM t1", Columns: []string{"s"}, Types: []string{"VARCHAR"}}
+	for _, value := range values {
+		q.Rows = append(q.Rows, []fixtureValue{{Type: "bytes", Value: value}})
+	}
+
+	want := map[string][]string{
+		"mysql": {`'line1\nline2'`, `'cr\r\nlf'`, `'nul\0byte'`, `'ctrl\Zz'`, `'back\\slash'`, `'quote\'\"'`, "'tab\tkept'"},
+		// postgres 的 standard_conforming_strings 下只需双写单引号, 控制字符原样有效 (text 类型不能包含 NUL, 不在此校验)
+		"postgres": {"'line1\nline2'", "'cr\r\nlf'", "'ctrl\x1az'", `'back\slash'`, `'quote''"'`, "'tab\tkept'"},
+	}
+	for dbType, literals := range want {
+		out := exportRows(t, replayArgs(dbType, q), q)
+		for _, literal := range literals {
+			if !strings.Contains(out, "("+literal+")") {
+				t.Errorf("%s: expected %q in output:\n%q", dbType, literal, out)
+			}
+		}
+		if dbType == "mysql" && strings.ContainsAny(out, "\x00\r\x1a") {
+			t.Errorf("mysql: raw control character in output:\n%q", out)
+		}
+	}
+}
+
+// postgresDDLFixtures 表 t1 的建表语句相关查询: serial 主键, 外键和一个普通索引
+func postgresDDLFixtures() []fixtureQuery {
+	rel := []fixtureValue{{Type: "string", Value: `"t1"`}}
+	str := func(v string) fixtureValue { return fixtureValue{Type: "bytes", Value: v} }
+	boolean := func(v bool) fixtureValue {
+		if v {
+			return fixtureValue{Type: "bool", Value: "true"}
+		}
+		return fixtureValue{Type: "bool", Value: "false"}
+	}
+	return []fixtureQuery{
+		fixtureQuery{
+			Query: `SELECT seq.relname, n.nspname, a.attname, d.deptype = 'i' FROM pg_class seq
+JOIN pg_namespace n ON n.oid = seq.relnamespace
+JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = seq.oid AND d.deptype IN ('a', 'i')
+JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+WHERE seq.relkind = 'S' AND d.refobjid = $1::regclass
+ORDER BY seq.relname`,
+			Args: rel, Columns: []string{"relname", "nspname", "attname", "identity"},
+			Rows: [][]fixtureValue{{str("t1_id_seq"), str("public"), str("id"), boolean(false)}},
+		},
+		fixtureQuery{
+			Query: `SELECT data_type, start_value, min_value, max_value, increment_by, cache_size, cycle, last_value
+FROM pg_sequences WHERE schemaname = $1 AND sequencename = $2`,
+			Args:    []fixtureValue{{Type: "string", Value: "public"}, {Type: "string", Value: "t1_id_seq"}},
+			Columns: []string{"data_type", "start_value", "min_value", "max_value", "increment_by", "cache_size", "cycle", "last_value"},
+			Rows: [][]fixtureValue{{str("integer"), {Type: "int", Value: "1"}, {Type: "int", Value: "1"}, {Type: "int", Value: "2147483647"},
+				{Type: "int", Value: "1"}, {Type: "int", Value: "1"}, boolean(false), {Type: "int", Value: "42"}}},
+		},
+		fixtureQuery{
+			Query: `SELECT a.attname, format_type(a.atttypid, a.atttypmod), COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+a.attnotnull, a.attidentity::text
+FROM pg_attribute a LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`,
+			Args: rel, Columns: []string{"attname", "format_type", "default", "attnotnull", "attidentity"},
+			Rows: [][]fixtureValue{
+				{str("id"), str("integer"), str("nextval('t1_id_seq'::regclass)"), boolean(true), str("")},
+				{str("name"), str("character varying(20)"), str(""), boolean(false), str("")},
+				{str("parent"), str("integer"), str(""), boolean(false), str("")},
+			},
+		},
+		fixtureQuery{
+			Query: `SELECT c.conname, pg_get_constraintdef(c.oid), COALESCE(f.relname, '')
+FROM pg_constraint c LEFT JOIN pg_class f ON f.oid = c.confrelid
+WHERE c.conrelid = $1::regclass AND c.contype IN ('p', 'u', 'c', 'f', 'x')
+ORDER BY c.contype <> 'p', c.contype = 'f', c.conname`,
+			Args: rel, Columns: []string{"conname", "def", "relname"},
+			Rows: [][]fixtureValue{
+				{str("t1_pkey"), str("PRIMARY KEY (id)"), str("")},
+				{str("t1_parent_fkey"), str("FOREIGN KEY (parent) REFERENCES t2(id)"), str("t2")},
+			},
+		},
+		fixtureQuery{
+			Query: `SELECT ci.relname, i.indisunique, pg_get_indexdef(i.indexrelid)
+FROM pg_index i JOIN pg_class ci ON ci.oid = i.indexrelid
+WHERE i.indrelid = $1::regclass AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = i.indexrelid AND c.conrelid = i.indrelid)
+ORDER BY ci.relname`,
+			Args: rel, Columns: []string{"relname", "indisunique", "def"},
+			Rows: [][]fixtureValue{{str("t1_name_idx"), boolean(false), str("CREATE INDEX t1_name_idx ON public.t1 USING btree (name)")}},
+		},
+	}
+}
+
+func TestPostgresCreateTable(t *testing.T) {
+	workArgs := replayArgs("postgres", postgresDDLFixtures()...)
+	workArgs.TablePrefix = "qa_"
+
+	want := `CREATE SEQUENCE IF NOT EXISTS "t1_id_seq" AS integer INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START WITH 1 CACHE 1 NO CYCLE;
+CREATE TABLE "qa_t1" (
+  "id" integer DEFAULT nextval('t1_id_seq'::regclass) NOT NULL,
+  "name" character varying(20),
+  "parent" integer,
+  CONSTRAINT "qa_t1_pkey" PRIMARY KEY (id),
+  CONSTRAINT "qa_t1_parent_fkey" FOREIGN KEY (parent) REFERENCES "qa_t2"(id)
+);
+ALTER SEQUENCE "t1_id_seq" OWNED BY "qa_t1"."id";
+CREATE INDEX "qa_t1_name_idx" ON "qa_t1" USING btree (name)`
+	if got := showCreateTable(workArgs, "t1"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPostgresAllModelCopyFormat(t *testing.T) {
+	count := fixtureQuery{Query: `SELECT COUNT(*) AS total FROM "t1"`, Columns: []string{"total"}, Rows: [][]fixtureValue{{{Type: "int", Value: "1"}}}}
+	data := fixtureQuery{
+		Query:   `SELECT * FROM "t1" LIMIT 1000 OFFSET 0`,
+		Columns: []string{"id", "name", "parent"},
+		Types:   []string{"INT4", "VARCHAR", "INT4"},
+		Rows:    [][]fixtureValue{{{Type: "int", Value: "1"}, {Type: "bytes", Value: "a\tb"}, {Type: "null"}}},
+	}
+	noPrimaryKey := fixtureQuery{
+		Query: `SELECT a.attname FROM pg_index i
+JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+WHERE i.indrelid = $1::regclass AND i.indisprimary
+ORDER BY array_position(i.indkey::int2[], a.attnum)`,
+		Args: []fixtureValue{{Type: "string", Value: `"t1"`}}, Columns: []string{"attname"},
+	}
+	workArgs := replayArgs("postgres", append(postgresDDLFixtures(), noPrimaryKey, count, data)...)
+	workArgs.Format = "copy"
+	workArgs.Chunk = true
+
+	f, err := ioutil.TempFile("", "db-export-tool-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	writeCreateTable(workArgs, f, "t1")
+	doWorkExportData(workArgs, f)
+	out, _ := ioutil.ReadFile(f.Name())
+
+	ddl := strings.Index(string(out), `CREATE TABLE "t1" (`)
+	copyAt := strings.Index(string(out), `COPY "t1" ("id", "name", "parent") FROM stdin;`+"\n1\ta\\tb\t\\N\n\\.\n")
+	setval := strings.Index(string(out), `SELECT setval('"t1_id_seq"', 42, true);`)
+	if ddl < 0 || copyAt < ddl || setval < copyAt {
+		t.Errorf("expected CREATE TABLE, COPY and setval in order, got:\n%s", out)
+	}
+}
+
+func TestConvertDumpCreateTable(t *testing.T) {
+	workArgs := workArgsT{DbType: "mysql", TargetType: "postgres", Logger: log.New(ioutil.Discard, "", 0), Summary: newDumpSummary()}
+	raw := "CREATE TABLE `t1` (\n  `id` int(11) unsigned NOT NULL AUTO_INCREMENT,\n  `name` varchar(20) COLLATE utf8mb4_bin DEFAULT NULL COMMENT 'a, b',\n" +
+		"  PRIMARY KEY (`id`),\n  KEY `idx_name` (`name`(10))\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;"
+	want := `CREATE TABLE "t1" (
+  "id" bigint GENERATED BY DEFAULT AS IDENTITY NOT NULL,
+  "name" varchar(20) DEFAULT NULL,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "t1_idx_name" ON "t1" ("name")`
+	if got := convertDumpStatement(workArgs, raw); got != want {
+		t.Errorf("mysql to postgres:\n%s\nwant:\n%s", got, want)
+	}
+
+	workArgs.DbType, workArgs.TargetType = "postgres", "mysql"
+	raw = "CREATE TABLE public.t1 (\n    id integer NOT NULL,\n    name character varying(20) DEFAULT 'x'::character varying,\n    ts timestamp without time zone DEFAULT now()\n);"
+	want = "CREATE TABLE `t1` (\n  `id` int NOT NULL,\n  `name` varchar(20) DEFAULT 'x',\n  `ts` datetime(6) DEFAULT CURRENT_TIMESTAMP(6)\n) DEFAULT CHARSET=utf8mb4"
+	if got := convertDumpStatement(workArgs, raw); got != want {
+		t.Errorf("postgres to mysql:\n%s\nwant:\n%s", got, want)
+	}
+	if got := convertDumpStatement(workArgs, "SET statement_timeout = 0;"); len(got) > 0 {
+		t.Errorf("session statement should be dropped, got: %s", got)
+	}
+}
+
+func TestSplitKeyRange(t *testing.T) {
+	cases := []struct {
+		min, max int64
+		n        int
+	}{
+		{1, 10, 3}, {1, 2, 5}, {7, 7, 4}, {math.MinInt64, math.MaxInt64, 4}, {math.MinInt64, math.MaxInt64, 1}, {-5, math.MaxInt64, 2},
+	}
+	for _, c := range cases {
+		segments := splitKeyRange(c.min, c.max, c.n)
+		if len(segments) == 0 || len(segments) > c.n || segments[0][0] != c.min || segments[len(segments)-1][1] != c.max {
+			t.Errorf("splitKeyRange(%d, %d, %d) = %v", c.min, c.max, c.n, segments)
+			continue
+		}
+		for k, seg := range segments {
+			if seg[0] > seg[1] || (k > 0 && seg[0] != segments[k-1][1]+1) {
+				t.Errorf("splitKeyRange(%d, %d, %d): bad segment %v in %v", c.min, c.max, c.n, seg, segments)
+			}
+		}
+	}
+}
+
+func TestChaosErrorsReturnedToCaller(t *testing.T) {
+	workArgs := replayArgs("mysql")
+	workArgs.Chaos = &chaosT{QueryErrorRate: 1, Seed: 1}
+	result := doWorkExportDataUseChunk(workArgs, ioutil.Discard, "SELECT * FROM `t1`", nil)
+	if result.Err != errChaosQuery || result.ErrCode != 30 {
+		t.Errorf("query error: %v, code %d", result.Err, result.ErrCode)
+	}
+
+	result = doWorkExportDataChunk(workArgs, ioutil.Discard, "SELECT * FROM `t1`", nil, 0)
+	if result.Err != errChaosQuery {
+		t.Errorf("chunk query error: %v", result.Err)
+	}
+}
+
+func TestFilterChangedSinceComparesTimes(t *testing.T) {
+	q := fixtureQuery{
+		Query:   "SELECT TABLE_NAME, UPDATE_TIME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()",
+		Columns: []string{"TABLE_NAME", "UPDATE_TIME"},
+		Types:   []string{"VARCHAR", "DATETIME"},
+		Rows: [][]fixtureValue{
+			{{Type: "string", Value: "t1"}, {Type: "time", Value: "2024-01-01T20:00:00Z"}},
+			{{Type: "string", Value: "t2"}, {Type: "time", Value: "2024-01-01T10:00:00+08:00"}},
+			{{Type: "string", Value: "t3"}, {Type: "bytes", Value: "2024-01-03 00:00:00"}},
+			{{Type: "string", Value: "t4"}, {Type: "null"}},
+		},
+	}
+	workArgs := replayArgs("mysql", q)
+	workArgs.ChangedSince, workArgs.SessionTimeZone = "2024-01-02 00:00:00", "+08:00"
+
+	changed := filterChangedSince(workArgs, []string{"t1", "t2", "t3", "t4"})
+	if strings.Join(changed, ",") != "t1,t3,t4" {
+		t.Errorf("changed tables: %v", changed)
+	}
+}
+
+func TestFilterChangedSincePostgresStats(t *testing.T) {
+	q := fixtureQuery{
+		Query: "SELECT s.schemaname, s.relname, s.schemaname = current_schema(), GREATEST(s.last_analyze, s.last_autoanalyze) " +
+			"FROM pg_stat_user_tables s JOIN pg_class c ON c.oid = s.relid " +
+			"WHERE s.n_mod_since_analyze = 0 AND c.relkind = 'r'",
+		Columns: []string{"schemaname", "relname", "?column?", "greatest"},
+		Types:   []string{"NAME", "NAME", "BOOL", "TIMESTAMPTZ"},
+		Rows: [][]fixtureValue{
+			{{Type: "string", Value: "public"}, {Type: "string", Value: "t1"}, {Type: "bool", Value: "true"}, {Type: "time", Value: "2023-12-31T00:00:00Z"}},
+			{{Type: "string", Value: "public"}, {Type: "string", Value: "t2"}, {Type: "bool", Value: "true"}, {Type: "time", Value: "2024-01-05T00:00:00Z"}},
+			{{Type: "string", Value: "audit"}, {Type: "string", Value: "t3"}, {Type: "bool", Value: "false"}, {Type: "time", Value: "2023-12-31T00:00:00Z"}},
+			{{Type: "string", Value: "public"}, {Type: "string", Value: "t4"}, {Type: "bool", Value: "true"}, {Type: "null"}},
+		},
+	}
+	workArgs := replayArgs("postgres", q)
+	workArgs.ChangedSince, workArgs.SessionTimeZone = "2024-01-01 00:00:00", "UTC"
+
+	changed := filterChangedSince(workArgs, []string{"t1", "t2", "audit.t3", "t4", "t5"})
+	if strings.Join(changed, ",") != "t2,t4,t5" {
+		t.Errorf("changed tables: %v", changed)
+	}
+}
+
+func TestLoadClientCredentials(t *testing.T) {
+	home, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(home)
+	}()
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("PGPASSFILE", os.Getenv("PGPASSFILE"))
+	_ = os.Setenv("HOME", home)
+
+	myCnf := "[client]\nuser = reader\npassword = \"secret\"\nhost = db.internal\nport = 3307\ndatabase = shop\n"
+	if err := ioutil.WriteFile(filepath.Join(home, ".my.cnf"), []byte(myCnf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	workArgs := workArgsT{DbType: "mysql", DbHost: "127.0.0.1:3306"}
+	loadClientCredentials(&workArgs)
+	if workArgs.DbUser != "reader" || workArgs.DbPassword != "secret" || workArgs.DbHost != "db.internal:3307" || workArgs.Database != "shop" {
+		t.Errorf("my.cnf: user %q, password %q, host %q, database %q", workArgs.DbUser, workArgs.DbPassword, workArgs.DbHost, workArgs.Database)
+	}
+
+	passFile := filepath.Join(home, "pgpass")
+	_ = os.Setenv("PGPASSFILE", passFile)
+	if err := ioutil.WriteFile(passFile, []byte("*:*:shop:reader:secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workArgs = workArgsT{DbType: "postgres", DbHost: "127.0.0.1:5432", Database: "shop"}
+	loadClientCredentials(&workArgs)
+	if workArgs.DbUser != "" || workArgs.DbPassword != "" {
+		t.Errorf("world readable pgpass used: user %q, password %q", workArgs.DbUser, workArgs.DbPassword)
+	}
+
+	_ = os.Chmod(passFile, 0600)
+	loadClientCredentials(&workArgs)
+	if workArgs.DbUser != "reader" || workArgs.DbPassword != "secret" {
+		t.Errorf("pgpass: user %q, password %q", workArgs.DbUser, workArgs.DbPassword)
+	}
+}
+
+func TestSSLModeRequireWithCA(t *testing.T) {
+	workArgs := workArgsT{DbType: "postgres", DbHost: "127.0.0.1:5432", DbUser: "u", Database: "d", DbSSLMode: "require", DbSSLCa: "/etc/ssl/ca.pem"}
+	dsn, err := buildDSN(workArgs)
+	if err != nil || !strings.Contains(dsn, "sslmode=verify-ca") {
+		t.Errorf("dsn: %s, err: %v", dsn, err)
+	}
+
+	workArgs.DbSSLCa = ""
+	if mode := sslMode(workArgs); mode != "require" {
+		t.Errorf("ssl mode without ca: %s", mode)
+	}
+}
+
+func TestLineageCommaJoin(t *testing.T) {
+	definitions := map[string]string{
+		"v_orders": "SELECT o.id, c.name FROM orders o, customers AS c, public.items, \"audit\".log l WHERE o.customer_id = c.id",
+	}
+	nodeTypes := map[string]string{"v_orders": "view", "orders": "table", "customers": "table", "items": "table"}
+
+	graph := buildLineageGraph(definitions, nodeTypes, "public")
+	var from []string
+	for _, edge := range graph.Edges {
+		from = append(from, edge.From)
+	}
+	if strings.Join(from, ",") != "orders,customers,items,audit.log" {
+		t.Errorf("lineage edges from: %v", from)
+	}
+}
+
+func TestSamplePushDown(t *testing.T) {
+	workArgs := replayArgs("postgres")
+	workArgs.Sample = "5%"
+	workArgs.Sampler, _ = newRowSampler(0, workArgs.Sample)
+	workArgs.Sampler.pushDown(workArgs)
+	if from := selectFrom(workArgs); from != `"t1" TABLESAMPLE BERNOULLI (5) REPEATABLE (0)` {
+		t.Errorf("postgres sample: %s", from)
+	}
+
+	workArgs = replayArgs("mysql")
+	workArgs.Sample, workArgs.PrimaryKey = "10%", []string{"id"}
+	workArgs.Sampler, _ = newRowSampler(0, workArgs.Sample)
+	workArgs.Sampler.pushDown(workArgs)
+	if where := dataWhere(workArgs); where != " WHERE CRC32(CONCAT_WS(',', `id`)) % 1000000 < 100000" {
+		t.Errorf("mysql sample: %s", where)
+	}
+	if !workArgs.Sampler.Keep() || !workArgs.Sampler.Keep() {
+		t.Errorf("rows dropped after sampling was pushed into the query")
+	}
+
+	// 每 N 行取一行按读取顺序计数, 不下推
+	for _, pk := range [][]string{{"id"}, nil} {
+		workArgs.Sample, workArgs.PrimaryKey = "3", pk
+		workArgs.Sampler, _ = newRowSampler(0, workArgs.Sample)
+		workArgs.Sampler.pushDown(workArgs)
+		if where := dataWhere(workArgs); where != "" {
+			t.Errorf("every nth row pushed into the query: %q", where)
+		}
+		var kept []bool
+		for k := 0; k < 6; k++ {
+			kept = append(kept, workArgs.Sampler.Keep())
+		}
+		if fmt.Sprint(kept) != "[true false false true false false]" {
+			t.Errorf("every 3rd row: %v", kept)
+		}
+	}
+}
+
+// offsetFixtures 没有主键的 mysql 表各一行, 按 offset 分页导出
+func offsetFixtures(tables ...string) []fixtureQuery {
+	var queries []fixtureQuery
+	for _, tbl := range tables {
+		queries = append(queries,
+			fixtureQuery{Query: `SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+ORDER BY ORDINAL_POSITION`, Args: []fixtureValue{{Type: "string", Value: tbl}}, Columns: []string{"COLUMN_NAME"}},
+			fixtureQuery{Query: "SELECT COUNT(*) AS total FROM `" + tbl + "`", Columns: []string{"total"}, Rows: [][]fixtureValue{{{Type: "int", Value: "1"}}}},
+			fixtureQuery{Query: "SELECT * FROM `" + tbl + "` LIMIT 1000 OFFSET 0", Columns: []string{"id"}, Types: []string{"INT"},
+				Rows: [][]fixtureValue{{{Type: "int", Value: "7"}}}},
+		)
+	}
+
+	return queries
+}
+
+func TestCheckpointResumeSkipsFinishedTables(t *testing.T) {
+	if filename := os.Getenv("DB_EXPORT_TEST_CHECKPOINT"); len(filename) > 0 {
+		// 子进程: t1 导出完成, t2 的分块查询失败后保存断点退出
+		workArgs := replayArgs("mysql", offsetFixtures("t1", "t2")...)
+		workArgs.Chunk, workArgs.CheckpointFile = true, filename
+		doWorkExportData(workArgs, ioutil.Discard)
+		workArgs.Table, workArgs.Chaos = "t2", &chaosT{QueryErrorRate: 1, Seed: 1}
+		doWorkExportData(workArgs, ioutil.Discard)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	filename := filepath.Join(dir, "checkpoint.json")
+
+	cmd := exec.Command(os.Args[0], "-test.run", "^TestCheckpointResumeSkipsFinishedTables$")
+	cmd.Env = append(os.Environ(), "DB_EXPORT_TEST_CHECKPOINT="+filename)
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the chunk failure to exit non-zero")
+	}
+
+	workArgs := replayArgs("mysql", offsetFixtures("t1", "t2")...)
+	workArgs.Chunk, workArgs.CheckpointFile = true, filename
+	var buf bytes.Buffer
+	for _, tbl := range []string{"t1", "t2"} {
+		workArgs.Table = tbl
+		doWorkExportData(workArgs, &buf)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "`t1`") || !strings.Contains(out, "INSERT INTO `t2`") {
+		t.Errorf("resume should export only t2, got:\n%s", out)
+	}
+}
+
+func TestMaskFileRuleBeatsPreset(t *testing.T) {
+	saved := workArgs
+	defer func() {
+		for col := range workArgs.Mask {
+			delete(workArgs.Mask, col)
+		}
+		workArgs = saved
+	}()
+
+	f, err := ioutil.TempFile("", "mask")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	_, _ = f.WriteString("email=fixed:nobody@example.com\n")
+	_ = f.Close()
+
+	// 与 main 中的顺序一致: 先读取 -mask-file, 再应用预设
+	if err := loadMaskFile(f.Name(), workArgs.Mask); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPreset("dev-seed-masked"); err != nil {
+		t.Fatal(err)
+	}
+
+	if workArgs.Mask["email"] != "fixed:nobody@example.com" || workArgs.Mask["phone"] != "partial:3" {
+		t.Errorf("mask rules: %v", workArgs.Mask)
+	}
+}
+
+func TestBeginSnapshotUsesDedicatedConnection(t *testing.T) {
+	workArgs := replayArgs("postgres",
+		fixtureQuery{Query: "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"},
+		fixtureQuery{Query: "SELECT pg_current_wal_lsn()::text", Columns: []string{"pg_current_wal_lsn"}, Rows: [][]fixtureValue{{{Type: "string", Value: "0/16B3748"}}}},
+	)
+	pool := workArgs.DB.(*sql.DB)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	snapshot, position, err := beginSnapshot(workArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position["wal_lsn"] != "0/16B3748" {
+		t.Errorf("position: %v", position)
+	}
+
+	// 快照连接被占用, 连接池中没有其他空闲连接
+	if idle := pool.Stats().Idle; idle != 0 || pool.Stats().InUse != 1 {
+		t.Errorf("pool stats: %+v", pool.Stats())
+	}
+	if err = snapshot.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Stats().InUse != 0 {
+		t.Errorf("snapshot connection not returned: %+v", pool.Stats())
+	}
+}
+
+func TestSaveIncrementalStateConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	filename := filepath.Join(dir, "state.json")
+
+	var wg sync.WaitGroup
+	for k := 0; k < 32; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			if errS := saveIncrementalState(filename, fmt.Sprintf("orders_%d", k), strconv.Itoa(k)); errS != nil {
+				t.Error(errS)
+			}
+		}(k)
+	}
+	wg.Wait()
+
+	state, err := loadIncrementalState(filename)
+	if err != nil || len(state) != 32 {
+		t.Errorf("state: %v, err: %v", state, err)
+	}
+}
+
+func TestShardLimitAppliesToLogicalTable(t *testing.T) {
+	workArgs := replayArgs("mysql", offsetFixtures("orders_1", "orders_2")...)
+	workArgs.Chunk, workArgs.Limit = true, 1
+
+	f, err := ioutil.TempFile("", "db-export-tool-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	doWorkExportDataShards(workArgs, f, shardGroup{Logical: "orders", Tables: []string{"orders_1", "orders_2"}})
+	out, _ := ioutil.ReadFile(f.Name())
+	if n := strings.Count(string(out), "(7)"); n != 1 {
+		t.Errorf("expected 1 row for the logical table, got %d:\n%s", n, out)
+	}
+}
+
+// TestAddSlashesServerRoundTrip 把 AddSlashes 转义后的字面量写入真实的 mysql 再读回, 校验服务端对 \0, \Z, \r 等转义的解析;
+// 设置 DB_EXPORT_TEST_MYSQL_DSN (如 user:pwd@tcp(127.0.0.1:3306)/test) 时运行, 否则跳过.
+func TestAddSlashesServerRoundTrip(t *testing.T) {
+	dsn := os.Getenv("DB_EXPORT_TEST_MYSQL_DSN")
+	if len(dsn) == 0 {
+		t.Skip("DB_EXPORT_TEST_MYSQL_DSN not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	// 临时表只在创建它的连接上可见
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{
+		"SET SESSION sql_mode = REPLACE(@@sql_mode, 'NO_BACKSLASH_ESCAPES', '')",
+		"CREATE TEMPORARY TABLE db_export_tool_escape (id INT PRIMARY KEY, v BLOB)",
+	} {
+		if _, err = db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	specials := []string{"\\", "'", `"`, "\x00", "\n", "\r", "\x1a", "\t", "x", "é", "%", "_"}
+	var values []string
+	for _, a := range specials {
+		for _, b := range specials {
+			values = append(values, a+b)
+		}
+	}
+
+	for k, value := range values {
+		insertSQL := fmt.Sprintf("INSERT INTO db_export_tool_escape (id, v) VALUES (%d, '%s')", k, tools.AddSlashes(value))
+		if _, err = db.Exec(insertSQL); err != nil {
+			t.Fatalf("%s: %v", insertSQL, err)
+		}
+	}
+
+	rows, err := db.Query("SELECT id, v FROM db_export_tool_escape ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var n int
+	for rows.Next() {
+		var id int
+		var got []byte
+		if err = rows.Scan(&id, &got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != values[id] {
+			t.Errorf("round trip of %q: escaped %q, read back %q", values[id], tools.AddSlashes(values[id]), got)
+		}
+		n++
+	}
+	if n != len(values) {
+		t.Errorf("read back %d rows, want %d", n, len(values))
+	}
+}
+
+func TestQuoteIdentKeepsDottedColumns(t *testing.T) {
+	mysqlArgs, pgArgs := workArgsT{DbType: "mysql"}, workArgsT{DbType: "postgres"}
+	cases := []struct{ got, want string }{
+		{quoteIdent(mysqlArgs, "a.b"), "`a.b`"},
+		{quoteIdent(pgArgs, `a."b`), `"a.""b"`},
+		{quoteTable(mysqlArgs, "information_schema.processlist"), "`information_schema`.`processlist`"},
+		{quoteTable(pgArgs, "audit.t1"), `"audit"."t1"`},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("got %s, want %s", c.got, c.want)
+		}
+	}
+
+	q := fixtureQuery{
+		Query:   "SELECT * FROM t1",
+		Columns: []string{"id", "a.b"},
+		Types:   []string{"INT", "VARCHAR"},
+		Rows:    [][]fixtureValue{{{Type: "int", Value: "1"}, {Type: "bytes", Value: "x"}}},
+	}
+	if out := exportRows(t, replayArgs("mysql", q), q); !strings.Contains(out, "INSERT INTO `t1` (`id`, `a.b`) VALUES") {
+		t.Errorf("dotted column split, got:\n%s", out)
+	}
+}
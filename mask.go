@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/internet-dev/db-export-tool/pkg/dump"
+)
+
+// maskShufflePool shuffle 规则每列保留的候选值个数
+const maskShufflePool = 1000
+
+// maskRule 列的脱敏规则
+type maskRule struct {
+	Kind  string // null, fixed, shuffle, partial
+	Value string // fixed 的取值
+	Keep  int    // partial 保留的前缀字符数
+}
+
+// parseMaskRule 解析 null, fixed:值, shuffle, partial[:保留字符数]
+func parseMaskRule(value string) (maskRule, error) {
+	kv := strings.SplitN(value, ":", 2)
+	switch kv[0] {
+	case "null", "shuffle":
+		if len(kv) == 2 {
+			return maskRule{}, fmt.Errorf("rule %s takes no argument: %s", kv[0], value)
+		}
+		return maskRule{Kind: kv[0]}, nil
+	case "fixed":
+		if len(kv) != 2 {
+			return maskRule{}, fmt.Errorf("rule fixed needs a value, format: fixed:value")
+		}
+		return maskRule{Kind: "fixed", Value: kv[1]}, nil
+	case "partial":
+		rule := maskRule{Kind: "partial", Keep: 1}
+		if len(kv) == 2 {
+			keep, err := strconv.Atoi(kv[1])
+			if err != nil || keep < 0 {
+				return maskRule{}, fmt.Errorf("invalid partial length: %s", kv[1])
+			}
+			rule.Keep = keep
+		}
+		return rule, nil
+	}
+
+	return maskRule{}, fmt.Errorf("unknown mask rule: %s, support: null, fixed:value, shuffle, partial[:n]", value)
+}
+
+// loadMaskFile 读取 -mask-file, 每行一条 [table.]col=rule, 空行和 # 开头的行忽略; 命令行上的 -mask 优先
+func loadMaskFile(filename string, masks kvFlag) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	var n int
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return fmt.Errorf("line %d: invalid rule: %s, format: [table.]col=rule", n, line)
+		}
+		if _, ok := masks[strings.TrimSpace(kv[0])]; !ok {
+			masks[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return scanner.Err()
+}
+
+// dataMasker -mask 的脱敏规则和 shuffle 的候选值, 所有 worker 共用
+type dataMasker struct {
+	rules map[string]maskRule // [table.]col -> 规则
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	pools map[string][]interface{} // table.col -> shuffle 候选值
+}
+
+func newDataMasker(masks kvFlag) (*dataMasker, error) {
+	if len(masks) == 0 {
+		return nil, nil
+	}
+
+	m := &dataMasker{
+		rules: make(map[string]maskRule, len(masks)),
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		pools: make(map[string][]interface{}),
+	}
+	for column, value := range masks {
+		rule, err := parseMaskRule(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", column, err)
+		}
+		m.rules[column] = rule
+	}
+
+	return m, nil
+}
+
+// Columns 返回查询结果中需要脱敏的列下标, table.col 优先于 col
+func (m *dataMasker) Columns(table string, columns []string) map[int]maskRule {
+	if m == nil {
+		return nil
+	}
+
+	masked := make(map[int]maskRule)
+	for k, col := range columns {
+		if rule, ok := m.rules[table+"."+col]; ok {
+			masked[k] = rule
+		} else if rule, ok := m.rules[col]; ok {
+			masked[k] = rule
+		}
+	}
+
+	return masked
+}
+
+// Apply 在转义之前替换 vals 中需要脱敏的值, NULL 保持为 NULL
+func (m *dataMasker) Apply(workArgs workArgsT, masked map[int]maskRule, columns []string, colTypes []string, vals []interface{}) {
+	for k, rule := range masked {
+		if vals[k] == nil {
+			continue
+		}
+
+		switch rule.Kind {
+		case "null":
+			vals[k] = nil
+		case "fixed":
+			vals[k] = rule.Value
+		case "partial":
+			vals[k] = partialMask(renderValue(workArgs, vals[k], colTypes[k]), rule.Keep)
+		case "shuffle":
+			vals[k] = m.shuffle(workArgs.Table+"."+columns[k], vals[k])
+		}
+	}
+}
+
+// ApplyDump 替换导出文件中一行 INSERT 值里需要脱敏的值, 规则同 Apply; 替换后的值都作为字符串输出
+func (m *dataMasker) ApplyDump(table string, masked map[int]maskRule, columns []string, values []dump.Value) {
+	for k, rule := range masked {
+		if values[k].Null {
+			continue
+		}
+
+		switch rule.Kind {
+		case "null":
+			values[k] = dump.Value{Null: true}
+		case "fixed":
+			values[k] = dump.Value{Text: rule.Value, Quoted: true}
+		case "partial":
+			values[k] = dump.Value{Text: partialMask(values[k].Text, rule.Keep), Quoted: true}
+		case "shuffle":
+			values[k] = m.shuffle(table+"."+columns[k], values[k]).(dump.Value)
+		}
+	}
+}
+
+// shuffle 返回同列中随机一行的值: 候选池未满时从已读到的值中抽取, 满后随机替换池中的一个值并返回被替换的值;
+// 大表只在最近的 maskShufflePool 个值中打乱, 各值与原来的行不再对应, 但不保证每个值恰好出现一次.
+func (m *dataMasker) shuffle(key string, val interface{}) interface{} {
+	if b, ok := val.([]byte); ok {
+		// 驱动返回的 []byte 在下一次 Scan 时可能被复用
+		val = append([]byte(nil), b...)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pool := m.pools[key]
+	if len(pool) < maskShufflePool {
+		pool = append(pool, val)
+		m.pools[key] = pool
+		return pool[m.rnd.Intn(len(pool))]
+	}
+
+	j := m.rnd.Intn(len(pool))
+	val, pool[j] = pool[j], val
+	return val
+}
+
+// partialMask 保留前 keep 个字符, 其余替换为 ***; 邮箱只处理 @ 之前的部分, 如 john@example.com -> j***@example.com
+func partialMask(value string, keep int) string {
+	var domain string
+	if at := strings.LastIndex(value, "@"); at > 0 {
+		value, domain = value[:at], value[at:]
+	}
+
+	runes := []rune(value)
+	if keep > len(runes) {
+		keep = len(runes)
+	}
+
+	return string(runes[:keep]) + "***" + domain
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// sourceDB -source 指定的一个分片连接
+type sourceDB struct {
+	Tag string
+	DB  *sql.DB
+}
+
+// openSources 连接 -source 指定的各个分片, 按标签排序, 保证输出顺序稳定
+func openSources(workArgs workArgsT) []sourceDB {
+	var tags []string
+	for tag := range workArgs.Sources {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	driver, code := "mysql", 110
+	if workArgs.DbType == "postgres" {
+		driver, code = "postgres", 111
+	}
+
+	var sources []sourceDB
+	for _, tag := range tags {
+		db, err := sql.Open(driver, workArgs.Sources[tag])
+		if err != nil {
+			errMsg(fmt.Sprintf("can not connect to source %s, err: %v", tag, err), code)
+		}
+		if err = db.Ping(); err != nil {
+			errMsg(fmt.Sprintf("can not connect to source %s, err: %v", tag, err), code)
+		}
+		sources = append(sources, sourceDB{Tag: tag, DB: db})
+	}
+
+	return sources
+}
+
+// doWorkExportDataMerge 依次从每个分片导出同一张表, 合并写到同一个输出中;
+// 表名列表和外键等元数据仍从主连接读取, 各分片的表结构需要一致.
+func doWorkExportDataMerge(workArgs workArgsT, output *os.File) {
+	for _, tbl := range fetchTables(workArgs) {
+		// 同一张表在各分片之间去重
+		dedupe := newTableDedupe(workArgs)
+		for k, source := range workArgs.SourceDBs {
+			log.Printf("[doWorkExportDataMerge] table: %s, source: %s", tbl, source.Tag)
+
+			taskArgs := workArgs
+			taskArgs.Table = tbl
+			taskArgs.DB = source.DB
+			taskArgs.SourceTag = source.Tag
+			taskArgs.Dedupe = dedupe
+			// 合并的数据写入同一张表, 只在第一个分片之前清空
+			taskArgs.SkipClear = k > 0
+			doWorkExportData(taskArgs, output)
+		}
+	}
+}
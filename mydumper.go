@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// chunkBoundary 输出在分块边界可以切换文件时实现该接口
+type chunkBoundary interface {
+	ChunkDone()
+}
+
+// rotatingFile 按 mydumper 的命名 <db>.<table>.00000.sql 写数据文件, 超过 maxSize 后在分块边界切换到下一个文件;
+// 首次写入时才创建文件, 空表没有数据文件.
+type rotatingFile struct {
+	dir     string
+	prefix  string
+	header  string
+	maxSize int64
+
+	index int
+	size  int64
+	f     *os.File
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.f == nil {
+		f, err := os.Create(filepath.Join(r.dir, fmt.Sprintf("%s.%05d.sql", r.prefix, r.index)))
+		if err != nil {
+			return 0, err
+		}
+		r.f = f
+		r.size = 0
+		if _, err = io.WriteString(f, r.header); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// ChunkDone 当前文件超过大小时关闭, 下一次写入使用下一个编号
+func (r *rotatingFile) ChunkDone() {
+	if r.f == nil || r.maxSize <= 0 || r.size < r.maxSize {
+		return
+	}
+
+	_ = r.f.Close()
+	r.f = nil
+	r.index++
+}
+
+func (r *rotatingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	return r.f.Close()
+}
+
+// doWorkExportMydumper 按 mydumper/myloader 的目录结构导出: metadata, <db>-schema-create.sql, <db>.<table>-schema.sql 和编号的数据文件
+func doWorkExportMydumper(workArgs workArgsT) {
+	log.Printf("[doWorkExportMydumper] start work, dir: %s", workArgs.MydumperDir)
+
+	if err := os.MkdirAll(workArgs.MydumperDir, 0755); err != nil {
+		log.Printf("[doWorkExportMydumper] can not create dir: %s, err: %v", workArgs.MydumperDir, err)
+		os.Exit(20)
+	}
+
+	var database, createDatabase string
+	if err := workArgs.DB.QueryRow("SELECT DATABASE()").Scan(&database); err != nil {
+		panic(err)
+	}
+	if err := workArgs.DB.QueryRow(fmt.Sprintf("SHOW CREATE DATABASE %s", quoteIdent(workArgs, database))).Scan(new(string), &createDatabase); err != nil {
+		panic(err)
+	}
+
+	// myloader 按文件名确定库名和表名
+	if target := targetDatabase(workArgs, database); target != database {
+		createDatabase = strings.Replace(createDatabase, "CREATE DATABASE "+quoteIdent(workArgs, database), "CREATE DATABASE "+quoteIdent(workArgs, target), 1)
+		database = target
+	}
+
+	var metadata strings.Builder
+	metadata.WriteString(fmt.Sprintf("Started dump at: %s\n", time.Now().Format("2006-01-02 15:04:05")))
+	if snapshot, position, err := beginSnapshot(workArgs); err != nil {
+		log.Printf("[doWorkExportMydumper] can not capture source position, err: %v", err)
+	} else {
+		defer func() {
+			_ = snapshot.Close()
+		}()
+		workArgs.DB = snapshot
+		// 快照只在一个连接上, 同一连接不能同时执行多个查询
+		workArgs.Parallel = 1
+		metadata.WriteString(fmt.Sprintf("SHOW MASTER STATUS:\n\tLog: %s\n\tPos: %s\n\tGTID:%s\n\n", position["File"], position["Position"], position["Executed_Gtid_Set"]))
+	}
+
+	header := fmt.Sprintf("/*!40101 SET NAMES %s*/;\n/*!40014 SET FOREIGN_KEY_CHECKS=0*/;\n\n", workArgs.DbCharset)
+	createFile(workArgs, database+"-schema-create.sql", func(f *os.File) {
+		_, _ = f.WriteString(createDatabase + ";\n")
+	})
+
+	for _, tbl := range orderedTables(workArgs) {
+		taskArgs := withTaskLogger(workArgs, tbl, 0)
+		taskArgs.Table = tbl
+
+		if workArgs.Model != "data" {
+			createFile(taskArgs, fmt.Sprintf("%s.%s-schema.sql", database, renameTable(workArgs, tbl)), func(f *os.File) {
+				_, _ = f.WriteString(header)
+				writeCreateTable(taskArgs, f, tbl)
+			})
+		}
+
+		if workArgs.Model != "schema" {
+			data := &rotatingFile{
+				dir:     workArgs.MydumperDir,
+				prefix:  database + "." + renameTable(workArgs, tbl),
+				header:  header,
+				maxSize: workArgs.MydumperFileSize << 20,
+			}
+			doWorkExportData(taskArgs, data)
+			if err := data.Close(); err != nil {
+				taskArgs.Logger.Printf("[doWorkExportMydumper] close data file err: %v", err)
+				os.Exit(20)
+			}
+		}
+	}
+
+	metadata.WriteString(fmt.Sprintf("Finished dump at: %s\n", time.Now().Format("2006-01-02 15:04:05")))
+	createFile(workArgs, "metadata", func(f *os.File) {
+		_, _ = f.WriteString(metadata.String())
+	})
+
+	log.Printf("[doWorkExportMydumper] jobs have done.")
+}
+
+// createFile 在 -mydumper-dir 下创建文件并交给 fn 写入
+func createFile(workArgs workArgsT, name string, fn func(f *os.File)) {
+	f, err := os.Create(filepath.Join(workArgs.MydumperDir, name))
+	if err != nil {
+		log.Printf("[createFile] can not create file: %s, err: %v", name, err)
+		os.Exit(20)
+	}
+	fn(f)
+	if err = f.Close(); err != nil {
+		log.Printf("[createFile] close file: %s, err: %v", name, err)
+		os.Exit(20)
+	}
+}
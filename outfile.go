@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// doWorkExportDataOutfile 由 mysql 服务器执行 SELECT ... INTO OUTFILE 直接写出数据文件, 速度最快但需要 FILE 权限和共享存储.
+// 数据文件使用 mysql 默认格式 (tab 分隔, \N 表示 NULL), 输出中只写对应的 LOAD DATA 语句.
+func doWorkExportDataOutfile(workArgs workArgsT, output io.Writer) {
+	name := fmt.Sprintf("%s.%s.txt", workArgs.Table, time.Now().Format("20060102150405"))
+	serverPath := path.Join(workArgs.OutfileDir, name)
+
+	localDir := workArgs.OutfileLocalDir
+	if len(localDir) == 0 {
+		localDir = workArgs.OutfileDir
+	}
+	localPath := filepath.Join(localDir, name)
+
+	var limit string
+	if workArgs.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d", workArgs.Limit)
+	}
+
+	querySQL := fmt.Sprintf("%s FROM %s%s%s INTO OUTFILE '%s' CHARACTER SET %s", selectFields(workArgs), quoteTable(workArgs, workArgs.Table), dataWhere(workArgs), limit,
+		workArgs.QueryEscapeFunc(serverPath), workArgs.DbCharset)
+	workArgs.Logger.Printf("[doWorkExportDataOutfile] sql: %s", querySQL)
+
+	start := time.Now()
+	res, err := workArgs.DB.Exec(querySQL)
+	if err != nil {
+		workArgs.Logger.Printf("[doWorkExportDataOutfile] select into outfile err: %v, need FILE privilege and secure_file_priv allowing %s", err, workArgs.OutfileDir)
+		os.Exit(35)
+	}
+	// SELECT INTO OUTFILE 的影响行数即写出的行数
+	if rowsNum, errR := res.RowsAffected(); errR == nil {
+		workArgs.Summary.AddRows(insertTable(workArgs), rowsNum)
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		workArgs.Logger.Printf("[doWorkExportDataOutfile] data file not visible locally: %v, set outfile-local-dir to the mount of outfile-dir", err)
+		os.Exit(35)
+	}
+	workArgs.Logger.Printf("[doWorkExportDataOutfile] data file: %s, size: %d, cost: %s", localPath, info.Size(), time.Since(start))
+	// SELECT INTO OUTFILE 由服务端一次写完, 只能在每个数据文件之后检查, 超出时不再导出后面的表
+	workArgs.Summary.AddBytes(info.Size())
+	workArgs.Summary.CheckLimits(workArgs)
+
+	// LOAD DATA 同样支持 IGNORE/REPLACE 处理重复键
+	var mode string
+	if workArgs.InsertMode == "insert-ignore" {
+		mode = "IGNORE "
+	} else if workArgs.InsertMode == "replace" {
+		mode = "REPLACE "
+	}
+
+	loadSQL := fmt.Sprintf("LOAD DATA LOCAL INFILE '%s' %sINTO TABLE %s CHARACTER SET %s;\n\n", workArgs.EscapeFunc(localPath), mode, quoteTable(workArgs, insertTable(workArgs)), workArgs.DbCharset)
+	_, _ = io.WriteString(output, loadSQL)
+}
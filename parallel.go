@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// doWorkExportDataParallel 把整数主键的取值范围切分为 -parallel 段, 每段由一个 worker 导出到临时文件, 最后按顺序拼接到 output
+func doWorkExportDataParallel(workArgs workArgsT, output io.Writer, pk string) {
+	var minKey, maxKey sql.NullInt64
+	col := quoteIdent(workArgs, pk)
+	rangeSQL := fmt.Sprintf(`SELECT MIN(%s), MAX(%s) FROM %s%s`, col, col, selectFrom(workArgs), dataWhere(workArgs))
+	err := workArgs.DB.QueryRow(rangeSQL).Scan(&minKey, &maxKey)
+	if err != nil {
+		workArgs.Logger.Printf("[doWorkExportDataParallel] primary key %s is not integer, fallback to serial, err: %v", pk, err)
+		doWorkExportDataByKeyset(workArgs, output, []string{pk}, "")
+		return
+	}
+	if !minKey.Valid {
+		workArgs.Logger.Printf("[doWorkExportDataParallel] table is empty")
+		return
+	}
+
+	segments := splitKeyRange(minKey.Int64, maxKey.Int64, workArgs.Parallel)
+	workArgs.Logger.Printf("[doWorkExportDataParallel] pk: %s, range: [%d, %d], segments: %d", pk, minKey.Int64, maxKey.Int64, len(segments))
+
+	files := make([]*os.File, len(segments))
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}
+		}
+	}()
+
+	for k := range segments {
+		f, errT := ioutil.TempFile("", programName+"-segment-")
+		if errT != nil {
+			panic(errT)
+		}
+		files[k] = f
+	}
+
+	var wg sync.WaitGroup
+	for k, seg := range segments {
+		wg.Add(1)
+		go func(k int, seg [2]int64) {
+			defer wg.Done()
+
+			taskArgs := withTaskLogger(workArgs, workArgs.Table, k+1)
+			rangeCond := fmt.Sprintf("%s >= %d AND %s <= %d", col, seg[0], col, seg[1])
+			_, _ = io.WriteString(files[k], fmt.Sprintf("/** segment: %d, %s */\n", k, rangeCond))
+			doWorkExportDataByKeyset(taskArgs, files[k], []string{pk}, rangeCond)
+			taskArgs.Logger.Printf("[doWorkExportDataParallel] segment %d done.", k)
+		}(k, seg)
+	}
+	wg.Wait()
+
+	for _, f := range files {
+		if _, errS := f.Seek(0, io.SeekStart); errS != nil {
+			panic(errS)
+		}
+		if _, errC := io.Copy(output, f); errC != nil {
+			panic(errC)
+		}
+	}
+}
+
+// splitKeyRange 把闭区间 [min, max] 切分为最多 n 个连续的闭区间; 区间宽度按 uint64 计算, 跨越整个 int64 范围时不溢出
+func splitKeyRange(min, max int64, n int) [][2]int64 {
+	if n < 1 {
+		n = 1
+	}
+	if min > max {
+		return nil
+	}
+
+	// 整个 int64 范围且 n 为 1 时 step 溢出为 0, 只有一段
+	step := (uint64(max)-uint64(min))/uint64(n) + 1
+	if step == 0 {
+		return [][2]int64{{min, max}}
+	}
+
+	var segments [][2]int64
+	lo := min
+	for {
+		hi := max
+		if uint64(max)-uint64(lo) >= step {
+			hi = int64(uint64(lo) + step - 1)
+		}
+		segments = append(segments, [2]int64{lo, hi})
+		if hi == max {
+			break
+		}
+		lo = hi + 1
+	}
+
+	return segments
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pgReferencesRe 外键定义中引用的表, 如 REFERENCES public.t2(id)
+var pgReferencesRe = regexp.MustCompile(`REFERENCES ([^(]+)\(`)
+
+// postgresCreateTable 由 pg_catalog 拼出 postgres 的建表语句, 作用同 mysql 的 SHOW CREATE TABLE:
+// 列 (类型, 默认值, NOT NULL, IDENTITY), 表约束 (pg_get_constraintdef) 和约束以外的索引 (pg_get_indexdef);
+// 列默认值引用的序列在建表之前创建. 返回的多条语句以分号分隔, 不含结尾分号.
+func postgresCreateTable(workArgs workArgsT, tbl string) string {
+	relation := quoteTable(workArgs, tbl)
+	target := renameTable(workArgs, tbl)
+	var statements []string
+
+	var sequences []tableSequence
+	for _, seq := range fetchTableSequences(workArgs, tbl) {
+		if seq.Identity {
+			continue
+		}
+		info, err := readSequence(workArgs, seq)
+		if err != nil {
+			workArgs.Logger.Printf("[postgresCreateTable] can not read sequence %s, err: %v", seq.Name, err)
+			continue
+		}
+		statements = append(statements, createSequenceSQL(sequenceName(workArgs, tbl, seq), info))
+		sequences = append(sequences, seq)
+	}
+
+	var lines []string
+	rows, err := workArgs.DB.Query(`SELECT a.attname, format_type(a.atttypid, a.atttypmod), COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+a.attnotnull, a.attidentity::text
+FROM pg_attribute a LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`, relation)
+	if err != nil {
+		panic(err)
+	}
+	for rows.Next() {
+		var name, dataType, def, identity string
+		var notNull bool
+		if errS := rows.Scan(&name, &dataType, &def, &notNull, &identity); errS != nil {
+			workArgs.Logger.Printf("[postgresCreateTable] rows.Scan err: %v", errS)
+			continue
+		}
+
+		line := "  " + quoteIdent(workArgs, name) + " " + dataType
+		switch identity {
+		case "a":
+			line += " GENERATED ALWAYS AS IDENTITY"
+		case "d":
+			line += " GENERATED BY DEFAULT AS IDENTITY"
+		default:
+			if len(def) > 0 {
+				line += " DEFAULT " + def
+			}
+		}
+		if notNull {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	_ = rows.Close()
+
+	rows, err = workArgs.DB.Query(`SELECT c.conname, pg_get_constraintdef(c.oid), COALESCE(f.relname, '')
+FROM pg_constraint c LEFT JOIN pg_class f ON f.oid = c.confrelid
+WHERE c.conrelid = $1::regclass AND c.contype IN ('p', 'u', 'c', 'f', 'x')
+ORDER BY c.contype <> 'p', c.contype = 'f', c.conname`, relation)
+	if err != nil {
+		panic(err)
+	}
+	for rows.Next() {
+		var name, def, referenced string
+		if errS := rows.Scan(&name, &def, &referenced); errS != nil {
+			workArgs.Logger.Printf("[postgresCreateTable] rows.Scan err: %v", errS)
+			continue
+		}
+		if len(referenced) > 0 && (len(workArgs.TableRenames) > 0 || len(workArgs.TablePrefix) > 0) {
+			def = pgReferencesRe.ReplaceAllLiteralString(def, "REFERENCES "+quoteTable(workArgs, renameTable(workArgs, referenced))+"(")
+		}
+		lines = append(lines, fmt.Sprintf("  CONSTRAINT %s %s", quoteIdent(workArgs, renameConstraint(workArgs, tbl, name)), def))
+	}
+	_ = rows.Close()
+
+	if len(lines) == 0 {
+		return ""
+	}
+	statements = append(statements, fmt.Sprintf("CREATE TABLE %s (\n%s\n)", quoteTable(workArgs, target), strings.Join(lines, ",\n")))
+
+	for _, seq := range sequences {
+		statements = append(statements, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s", sequenceName(workArgs, tbl, seq), quoteTable(workArgs, target), quoteIdent(workArgs, seq.Column)))
+	}
+
+	// 约束对应的索引随约束创建, 这里只写出其他索引
+	rows, err = workArgs.DB.Query(`SELECT ci.relname, i.indisunique, pg_get_indexdef(i.indexrelid)
+FROM pg_index i JOIN pg_class ci ON ci.oid = i.indexrelid
+WHERE i.indrelid = $1::regclass AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = i.indexrelid AND c.conrelid = i.indrelid)
+ORDER BY ci.relname`, relation)
+	if err != nil {
+		panic(err)
+	}
+	for rows.Next() {
+		var name, def string
+		var unique bool
+		if errS := rows.Scan(&name, &unique, &def); errS != nil {
+			workArgs.Logger.Printf("[postgresCreateTable] rows.Scan err: %v", errS)
+			continue
+		}
+		k := strings.Index(def, " USING ")
+		if k < 0 {
+			workArgs.Logger.Printf("[postgresCreateTable] unexpected index definition: %s", def)
+			continue
+		}
+
+		create := "CREATE INDEX "
+		if unique {
+			create = "CREATE UNIQUE INDEX "
+		}
+		if workArgs.IfNotExists {
+			create += "IF NOT EXISTS "
+		}
+		statements = append(statements, fmt.Sprintf("%s%s ON %s%s", create, quoteIdent(workArgs, renameConstraint(workArgs, tbl, name)),
+			quoteTable(workArgs, target), def[k:]))
+	}
+	_ = rows.Close()
+
+	return strings.Join(statements, ";\n")
+}
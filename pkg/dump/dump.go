@@ -0,0 +1,344 @@
+package dump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Statement 从 SQL 文件中读出的一条语句
+type Statement struct {
+	Raw    string  // 原始语句, 包含前面的注释和结尾的分号
+	Insert *Insert // INSERT/REPLACE 语句的解析结果, 其他语句为 nil
+}
+
+// Insert 解析后的 INSERT 语句
+type Insert struct {
+	Table   string
+	Columns []string // 语句中没有列清单时为空
+	Rows    [][]Value
+	Tail    string // 值列表之后的子句, 如 ON DUPLICATE KEY UPDATE, ON CONFLICT, RETURNING, 没有时为空
+}
+
+// Value 单个字段值, Quoted 的值已经去掉引号并还原转义
+type Value struct {
+	Text   string
+	Null   bool
+	Quoted bool
+}
+
+var (
+	insertRe = regexp.MustCompile("(?is)^(?:INSERT|REPLACE)\\s+(?:IGNORE\\s+)?INTO\\s+((?:`[^`]+`|\"[^\"]+\"|[\\w$]+)(?:\\.(?:`[^`]+`|\"[^\"]+\"|[\\w$]+))?)\\s*(?:\\(([^)]*)\\))?\\s*VALUES\\s*")
+	identRe  = regexp.MustCompile("`([^`]+)`|\"([^\"]+)\"|([\\w$]+)")
+)
+
+// Scanner 逐条读取 SQL 语句
+type Scanner struct {
+	r *bufio.Reader
+
+	// BackslashEscapes 字符串中的反斜杠是否为转义符, mysql 默认为 true, postgres 标准字符串为 false
+	BackslashEscapes bool
+	// HashComments # 是否开始单行注释, 只有 mysql 如此, postgres 中 # 是运算符
+	HashComments bool
+}
+
+// NewScanner mysql 为 true 时按 mysql 的语法读取 (反斜杠转义, # 注释), 否则按 postgres
+func NewScanner(r io.Reader, mysql bool) *Scanner {
+	return &Scanner{
+		r:                bufio.NewReaderSize(r, 1<<20),
+		BackslashEscapes: mysql,
+		HashComments:     mysql,
+	}
+}
+
+// Next 返回下一条语句, 读完时返回 io.EOF
+func (s *Scanner) Next() (*Statement, error) {
+	var buf strings.Builder
+	var quote byte
+	var lineComment, blockComment, escaped bool
+	var prev byte
+
+	for {
+		c, err := s.r.ReadByte()
+		if err == io.EOF {
+			if len(strings.TrimSpace(buf.String())) == 0 {
+				return nil, io.EOF
+			}
+			return s.parse(buf.String())
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(c)
+
+		switch {
+		case lineComment:
+			if c == '\n' {
+				lineComment = false
+			}
+		case blockComment:
+			if prev == '*' && c == '/' {
+				blockComment = false
+				c = 0
+			}
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if c == '\\' && quote != '`' && s.BackslashEscapes {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' && s.HashComments:
+			lineComment = true
+		case prev == '-' && c == '-':
+			lineComment = true
+		case prev == '/' && c == '*':
+			blockComment = true
+			c = 0
+		case c == ';':
+			return s.parse(buf.String())
+		}
+		prev = c
+	}
+}
+
+func (s *Scanner) parse(raw string) (*Statement, error) {
+	stmt := &Statement{Raw: raw}
+
+	body := strings.TrimSpace(StripComments(raw, s.HashComments))
+	m := insertRe.FindStringSubmatchIndex(body)
+	if m == nil {
+		return stmt, nil
+	}
+
+	insert := &Insert{Table: unquoteIdent(body[m[2]:m[3]])}
+	if m[4] >= 0 {
+		for _, im := range identRe.FindAllStringSubmatch(body[m[4]:m[5]], -1) {
+			insert.Columns = append(insert.Columns, im[1]+im[2]+im[3])
+		}
+	}
+
+	rows, tail, err := s.parseRows(strings.TrimSuffix(strings.TrimSpace(body[m[1]:]), ";"))
+	if err != nil {
+		return nil, fmt.Errorf("parse insert into %s: %v", insert.Table, err)
+	}
+	insert.Rows = rows
+	insert.Tail = tail
+	stmt.Insert = insert
+
+	return stmt, nil
+}
+
+// parseRows 解析 (v1, v2), (v3, v4) 形式的值列表, 值列表之后的子句原样返回
+func (s *Scanner) parseRows(text string) ([][]Value, string, error) {
+	var rows [][]Value
+	i := 0
+	n := len(text)
+
+	skipSpace := func() {
+		for i < n && (text[i] == ' ' || text[i] == '\n' || text[i] == '\r' || text[i] == '\t') {
+			i++
+		}
+	}
+
+	for {
+		skipSpace()
+		if i >= n && len(rows) > 0 {
+			return rows, "", nil
+		}
+		if i >= n || text[i] != '(' {
+			return nil, "", fmt.Errorf("expect ( at offset %d", i)
+		}
+		i++
+
+		var row []Value
+		skipSpace()
+		if i < n && text[i] == ')' {
+			// mysql 的 VALUES () 使用各列的默认值
+			i++
+			rows = append(rows, row)
+			skipSpace()
+			if i < n && text[i] == ',' {
+				i++
+				continue
+			}
+			return rows, strings.TrimSpace(text[i:]), nil
+		}
+		for {
+			skipSpace()
+			if i >= n {
+				return nil, "", fmt.Errorf("unexpected end of values")
+			}
+
+			var value Value
+			// mysql 中双引号也是字符串
+			if text[i] == '\'' || (text[i] == '"' && s.BackslashEscapes) {
+				str, next, err := s.readString(text, i)
+				if err != nil {
+					return nil, "", err
+				}
+				value = Value{Text: str, Quoted: true}
+				i = next
+			} else {
+				start := i
+				depth := 0
+				for i < n {
+					c := text[i]
+					if c == '\'' {
+						_, next, err := s.readString(text, i)
+						if err != nil {
+							return nil, "", err
+						}
+						i = next
+						continue
+					}
+					if c == '(' {
+						depth++
+					} else if c == ')' {
+						if depth == 0 {
+							break
+						}
+						depth--
+					} else if c == ',' && depth == 0 {
+						break
+					}
+					i++
+				}
+				token := strings.TrimSpace(text[start:i])
+				value = Value{Text: token, Null: strings.EqualFold(token, "NULL")}
+			}
+			row = append(row, value)
+
+			skipSpace()
+			if i >= n {
+				return nil, "", fmt.Errorf("unexpected end of values")
+			}
+			if text[i] == ',' {
+				i++
+				continue
+			}
+			if text[i] == ')' {
+				i++
+				break
+			}
+			return nil, "", fmt.Errorf("unexpected %q at offset %d", text[i], i)
+		}
+		rows = append(rows, row)
+
+		// 元组之间以逗号分隔, 之后不是逗号时值列表结束
+		skipSpace()
+		if i < n && text[i] == ',' {
+			i++
+			continue
+		}
+		return rows, strings.TrimSpace(text[i:]), nil
+	}
+}
+
+// readString 读取从 start 开始的引号字符串, 返回还原后的内容和结束引号之后的位置
+func (s *Scanner) readString(text string, start int) (string, int, error) {
+	var sb strings.Builder
+	quote := text[start]
+	i := start + 1
+	n := len(text)
+
+	for i < n {
+		c := text[i]
+		if c == '\\' && s.BackslashEscapes && i+1 < n {
+			sb.WriteString(unescapeByte(text[i+1]))
+			i += 2
+			continue
+		}
+		if c == quote {
+			if i+1 < n && text[i+1] == quote {
+				sb.WriteByte(quote)
+				i += 2
+				continue
+			}
+			return sb.String(), i + 1, nil
+		}
+		sb.WriteByte(c)
+		i++
+	}
+
+	return "", n, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func unescapeByte(c byte) string {
+	switch c {
+	case '0':
+		return "\x00"
+	case 'b':
+		return "\b"
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case 'Z':
+		return "\x1a"
+	case '%', '_':
+		return "\\" + string(c)
+	default:
+		return string(c)
+	}
+}
+
+func unquoteIdent(ident string) string {
+	ident = strings.NewReplacer("`", "", `"`, "").Replace(ident)
+	if idx := strings.LastIndex(ident, "."); idx >= 0 {
+		return ident[idx+1:]
+	}
+
+	return ident
+}
+
+// StripComments 去掉语句中引号之外的 -- /* */ 注释, mysql 为 true 时还包括 # 注释, 字符串中的反斜杠为转义符
+func StripComments(raw string, mysql bool) string {
+	var sb strings.Builder
+	var quote byte
+	n := len(raw)
+
+	for i := 0; i < n; i++ {
+		c := raw[i]
+		if quote != 0 {
+			sb.WriteByte(c)
+			if c == '\\' && quote != '`' && mysql && i+1 < n {
+				i++
+				sb.WriteByte(raw[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			sb.WriteByte(c)
+		case (c == '#' && mysql) || (c == '-' && i+1 < n && raw[i+1] == '-'):
+			for i < n && raw[i] != '\n' {
+				i++
+			}
+			sb.WriteByte('\n')
+		case c == '/' && i+1 < n && raw[i+1] == '*':
+			end := strings.Index(raw[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 3
+			}
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
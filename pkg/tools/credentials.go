@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ParseMyCnf 读取 my.cnf 中 [client] 和 [mysqldump] 段的配置项, 后出现的覆盖先出现的
+func ParseMyCnf(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	conf := make(map[string]string)
+	var section string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' || line[0] == '!' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		if section != "client" && section != "mysqldump" {
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.Replace(strings.TrimSpace(kv[0]), "_", "-", -1)
+		var value string
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+		}
+		conf[key] = value
+	}
+
+	return conf, scanner.Err()
+}
+
+// LookupPgPass 按 .pgpass 规则(hostname:port:database:username:password, * 通配)查找第一条匹配记录.
+// user 为空时匹配任意用户, 并返回该记录的用户名.
+func LookupPgPass(filename, host, port, database, user string) (string, string, bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", "", false, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := splitPgPassLine(line)
+		if len(fields) != 5 {
+			continue
+		}
+
+		if !pgPassMatch(fields[0], host) || !pgPassMatch(fields[1], port) || !pgPassMatch(fields[2], database) {
+			continue
+		}
+
+		if len(user) > 0 {
+			if pgPassMatch(fields[3], user) {
+				return user, fields[4], true, nil
+			}
+			continue
+		}
+
+		if fields[3] != "*" {
+			return fields[3], fields[4], true, nil
+		}
+	}
+
+	return "", "", false, scanner.Err()
+}
+
+// splitPgPassLine 按冒号切分, 支持 \: 和 \\ 转义
+func splitPgPassLine(line string) []string {
+	var fields []string
+	var field strings.Builder
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) {
+			i++
+			field.WriteByte(line[i])
+			continue
+		}
+		if c == ':' {
+			fields = append(fields, field.String())
+			field.Reset()
+			continue
+		}
+		field.WriteByte(c)
+	}
+
+	return append(fields, field.String())
+}
+
+func pgPassMatch(pattern, value string) bool {
+	return pattern == "*" || pattern == value
+}
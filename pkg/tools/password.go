@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ReadPasswordFile 读取密码文件的第一行
+func ReadPasswordFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	pwd := strings.SplitN(string(data), "\n", 2)[0]
+	return strings.TrimRight(pwd, "\r"), nil
+}
+
+// AskPassword 在终端提示输入密码, 输入过程不回显; 标准输入不是终端或无法关闭回显时返回错误, 不以明文读取密码.
+// go.mod 为 go 1.12, golang.org/x/term 依赖的 x/sys 需要更高版本, 用 stty 关闭回显.
+func AskPassword(prompt string) (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return "", errors.New("stdin is not a terminal, use -db-password-file or ~/.my.cnf / ~/.pgpass instead")
+	}
+
+	if err := stty("-echo"); err != nil {
+		return "", fmt.Errorf("can not disable terminal echo: %v", err)
+	}
+	defer func() {
+		_ = stty("echo")
+		_, _ = fmt.Fprintln(os.Stderr)
+	}()
+
+	_, _ = fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+
+	return cmd.Run()
+}
@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	selectAliasRe  = regexp.MustCompile(`(?is)^(.*\S)\s+AS\s+([` + "`" + `"]?)([^\s` + "`" + `"]+)([` + "`" + `"]?)$`)
+	selectColumnRe = regexp.MustCompile(`^[` + "`" + `"]?[A-Za-z_][A-Za-z0-9_$]*[` + "`" + `"]?(\.[` + "`" + `"]?[A-Za-z_][A-Za-z0-9_$]*[` + "`" + `"]?)*$`)
+)
+
+// SelectExpressions 解析查询最外层 SELECT 的列表, 返回输出列名 -> 表达式; 只识别 AS 别名和列引用, 其他表达式跳过
+func SelectExpressions(query string) map[string]string {
+	exprs := make(map[string]string)
+
+	items := splitSelectList(query)
+	for _, item := range items {
+		item = strings.Join(strings.Fields(item), " ")
+		if m := selectAliasRe.FindStringSubmatch(item); m != nil {
+			exprs[m[3]] = m[1]
+			continue
+		}
+		if selectColumnRe.MatchString(item) {
+			parts := strings.Split(item, ".")
+			exprs[strings.Trim(parts[len(parts)-1], "`\"")] = item
+		}
+	}
+
+	return exprs
+}
+
+// splitSelectList 按最外层的逗号拆分 SELECT 和 FROM 之间的列表, 跳过括号和引号中的内容
+func splitSelectList(query string) []string {
+	upper := strings.ToUpper(query)
+	start := strings.Index(upper, "SELECT")
+	if start < 0 {
+		return nil
+	}
+	start += len("SELECT")
+	if rest := strings.TrimSpace(upper[start:]); strings.HasPrefix(rest, "DISTINCT ") {
+		start = strings.Index(upper, "DISTINCT") + len("DISTINCT")
+	}
+
+	var items []string
+	var depth int
+	var quote byte
+	begin := start
+	for i := start; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && c == ',':
+			items = append(items, query[begin:i])
+			begin = i + 1
+		case depth == 0 && isKeywordAt(upper, i, "FROM"):
+			return append(items, query[begin:i])
+		}
+	}
+
+	return append(items, query[begin:])
+}
+
+// isKeywordAt 返回 s[i:] 是否以独立的关键字开头
+func isKeywordAt(s string, i int, keyword string) bool {
+	if !strings.HasPrefix(s[i:], keyword) {
+		return false
+	}
+	isIdent := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+	}
+	if i > 0 && isIdent(s[i-1]) {
+		return false
+	}
+	end := i + len(keyword)
+
+	return end >= len(s) || !isIdent(s[end])
+}
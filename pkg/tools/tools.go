@@ -1,16 +1,195 @@
 package tools
 
-import "strings"
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
 
-func AddSlashes(str string) string {
-	str = strings.Replace(str, `\`, `\\`, -1)
-	str = strings.Replace(str, "'", `\'`, -1)
-	str = strings.Replace(str, `"`, `\"`, -1)
+// mysqlEscaper 转义引号, 反斜杠和控制字符; 换行, NUL 和 Ctrl-Z 原样输出时会破坏导入时的语句解析
+var mysqlEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"'", `\'`,
+	`"`, `\"`,
+	"\x00", `\0`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x1a", `\Z`,
+)
 
-	return str
+func AddSlashes(str string) string {
+	return mysqlEscaper.Replace(str)
 }
 
 func PgEscape(origin string) (after string) {
 	after = strings.Replace(origin, `'`, `''`, -1)
 	return
 }
+
+func InArray(needle string, haystack []string) bool {
+	for _, item := range haystack {
+		if item == needle {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchAny 返回 name 是否匹配任一 glob 模式, 如 audit_*
+func MatchAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EditDistance 返回两个字符串的 Levenshtein 编辑距离
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+
+	return a
+}
+
+// definerRe 匹配视图, 触发器, 存储过程和事件中的 DEFINER=user@host, 不匹配 SQL SECURITY DEFINER
+var definerRe = regexp.MustCompile("(?i)\\s*\\bDEFINER\\s*=\\s*(?:`[^`]*`|'[^']*'|\"[^\"]*\"|[^\\s@]+)@(?:`[^`]*`|'[^']*'|\"[^\"]*\"|[^\\s*]+)")
+
+// RewriteDefiner 把语句中的 DEFINER 子句替换为 definer (user@host), definer 为空时去掉
+func RewriteDefiner(sql string, definer string) string {
+	if len(definer) == 0 {
+		return definerRe.ReplaceAllString(sql, "")
+	}
+
+	k := strings.LastIndex(definer, "@")
+	user, host := strings.Trim(definer[:k], "`'\""), strings.Trim(definer[k+1:], "`'\"")
+	clause := " DEFINER=`" + strings.Replace(user, "`", "``", -1) + "`@`" + strings.Replace(host, "`", "``", -1) + "`"
+
+	return definerRe.ReplaceAllLiteralString(sql, clause)
+}
+
+var (
+	charsetRe   = regexp.MustCompile(`(?i)\b(CHARSET|CHARACTER SET)(\s*=\s*|\s+)(\w+)`)
+	collationRe = regexp.MustCompile(`(?i)\b(COLLATE)(\s*=\s*|\s+)(\w+)`)
+)
+
+// ParseRenames 解析 from:to,from:to 形式的替换列表, 名称不区分大小写
+func ParseRenames(value string) (map[string]string, error) {
+	renames := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			return nil, fmt.Errorf("invalid rename: %s, format: from:to", item)
+		}
+		renames[strings.ToLower(kv[0])] = kv[1]
+	}
+
+	return renames, nil
+}
+
+// RewriteDatabase 把 `from`.xxx 形式的库名限定替换为 `to`.xxx, 库名区分大小写
+func RewriteDatabase(sql string, from string, to string) string {
+	quote := func(name string) string {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`."
+	}
+
+	return strings.Replace(sql, quote(from), quote(to), -1)
+}
+
+// RewriteCharset 替换建表语句中的字符集和排序规则; 未单独指定的排序规则按字符集前缀替换, 如 utf8_general_ci -> utf8mb4_general_ci
+func RewriteCharset(sql string, charsets map[string]string, collations map[string]string) string {
+	rewrite := func(re *regexp.Regexp, rename func(name string) (string, bool)) {
+		sql = re.ReplaceAllStringFunc(sql, func(match string) string {
+			m := re.FindStringSubmatch(match)
+			if name, ok := rename(m[3]); ok {
+				return m[1] + m[2] + name
+			}
+			return match
+		})
+	}
+
+	rewrite(charsetRe, func(name string) (string, bool) {
+		to, ok := charsets[strings.ToLower(name)]
+		return to, ok
+	})
+	rewrite(collationRe, func(name string) (string, bool) {
+		if to, ok := collations[strings.ToLower(name)]; ok {
+			return to, true
+		}
+		if k := strings.Index(name, "_"); k > 0 {
+			if to, ok := charsets[strings.ToLower(name[:k])]; ok {
+				return to + name[k:], true
+			}
+		}
+		return "", false
+	})
+
+	return sql
+}
+
+var engineRe = regexp.MustCompile(`(?i)\b(ENGINE)(\s*=\s*|\s+)(\w+)`)
+
+// RewriteEngine 替换建表语句中的存储引擎
+func RewriteEngine(sql string, engines map[string]string) string {
+	return engineRe.ReplaceAllStringFunc(sql, func(match string) string {
+		m := engineRe.FindStringSubmatch(match)
+		if to, ok := engines[strings.ToLower(m[3])]; ok {
+			return m[1] + m[2] + to
+		}
+		return match
+	})
+}
+
+// ToValidUTF8 把连续的非法 UTF-8 字节替换为一个 replacement, 同 go 1.13 的 strings.ToValidUTF8
+func ToValidUTF8(s string, replacement string) string {
+	var sb strings.Builder
+	invalid := false
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			if !invalid {
+				sb.WriteString(replacement)
+				invalid = true
+			}
+			i++
+			continue
+		}
+		sb.WriteString(s[i : i+size])
+		invalid = false
+		i += size
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// unescapeMySQL 按 mysql 解析单引号字符串字面量的规则还原转义, 用于校验 AddSlashes 的输出可以无损导入
+func unescapeMySQL(t *testing.T, literal string) string {
+	t.Helper()
+
+	var sb strings.Builder
+	for i := 0; i < len(literal); i++ {
+		c := literal[i]
+		if c == '\'' {
+			t.Fatalf("unescaped quote at offset %d in %q", i, literal)
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(literal) {
+			t.Fatalf("dangling backslash in %q", literal)
+		}
+		switch literal[i] {
+		case '0':
+			sb.WriteByte(0)
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'Z':
+			sb.WriteByte('\x1a')
+		case 't':
+			sb.WriteByte('\t')
+		default:
+			sb.WriteByte(literal[i])
+		}
+	}
+
+	return sb.String()
+}
+
+func TestAddSlashes(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"it's", `it\'s`},
+		{`say "hi"`, `say \"hi\"`},
+		{`C:\path`, `C:\\path`},
+		{"a\nb", `a\nb`},
+		{"a\r\nb", `a\r\nb`},
+		{"a\x00b", `a\0b`},
+		{"a\x1ab", `a\Zb`},
+		{"\\\n", `\\\n`},
+		{"tab\tstays", "tab\tstays"},
+		{"中文'\n", `中文\'\n`},
+	}
+
+	for _, c := range cases {
+		if got := AddSlashes(c.in); got != c.want {
+			t.Errorf("AddSlashes(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestAddSlashesRoundTrip(t *testing.T) {
+	specials := []string{"\\", "'", `"`, "\x00", "\n", "\r", "\x1a", "\t", "x", "é"}
+	for _, a := range specials {
+		for _, b := range specials {
+			for _, c := range specials {
+				value := a + b + c
+				escaped := AddSlashes(value)
+				if strings.ContainsAny(escaped, "\x00\n\r\x1a") {
+					t.Errorf("AddSlashes(%q) = %q keeps a raw control character", value, escaped)
+				}
+				if got := unescapeMySQL(t, escaped); got != value {
+					t.Errorf("round trip of %q: escaped %q, restored %q", value, escaped, got)
+				}
+			}
+		}
+	}
+}
+
+func TestPgEscape(t *testing.T) {
+	if got := PgEscape(`it's \n`); got != `it''s \n` {
+		t.Errorf("PgEscape = %q", got)
+	}
+}
+
+func TestToValidUTF8(t *testing.T) {
+	cases := map[string]string{
+		"abc":        "abc",
+		"a\xffb":     "a�b",
+		"a\xff\xfeb": "a�b",
+		"中\xe4\xb8文": "中�文",
+		"\xffa\xff":  "�a�",
+		"�\xff":      "��",
+	}
+	for in, want := range cases {
+		if got := ToValidUTF8(in, "�"); got != want {
+			t.Errorf("ToValidUTF8(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAskPasswordNotTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.WriteString("secret\n")
+	_ = w.Close()
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	}()
+
+	if pwd, err := AskPassword("password: "); err == nil {
+		t.Errorf("read password %q from a pipe", pwd)
+	}
+}
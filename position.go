@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// sqlQueryer 导出查询使用的连接, 连接池 *sql.DB 和持有快照事务的 *snapshotConn 都满足
+type sqlQueryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// snapshotConn 从连接池取出的专用连接, 其上开启了一致性快照事务, 之后的导出查询都经由它执行.
+// database/sql 不会为 *sql.Conn 重新建立连接, 连接断开后直接退出, 不在快照之外继续导出.
+type snapshotConn struct {
+	conn *sql.Conn
+}
+
+func (c *snapshotConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	res, err := c.conn.ExecContext(context.Background(), query, args...)
+	c.check(err)
+	return res, err
+}
+
+func (c *snapshotConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := c.conn.QueryContext(context.Background(), query, args...)
+	c.check(err)
+	return rows, err
+}
+
+func (c *snapshotConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRowContext(context.Background(), query, args...)
+}
+
+// check 快照连接已断开时退出, 导出的数据与头部的位置不再一致
+func (c *snapshotConn) check(err error) {
+	if err == driver.ErrBadConn || err == sql.ErrConnDone || err == mysql.ErrInvalidConn {
+		log.Printf("[snapshotConn] snapshot connection lost, the export is not consistent with the source position, err: %v", err)
+		os.Exit(21)
+	}
+}
+
+// Close 结束快照事务并把连接归还连接池
+func (c *snapshotConn) Close() error {
+	_, _ = c.conn.ExecContext(context.Background(), "ROLLBACK")
+	return c.conn.Close()
+}
+
+// beginSnapshot 从连接池取出一个专用连接, 在其上开启一致性快照事务并读取位置, 返回的连接用于之后的全部导出查询;
+// mysql 与 mysqldump --single-transaction --source-data 相同, 在全局读锁内开启快照并读取 binlog 位置, 没有 RELOAD 权限时不加锁,
+// 位置可能略早于快照; postgres 在 REPEATABLE READ 事务的第一条语句中读取 WAL 位置, 快照同时建立.
+func beginSnapshot(workArgs workArgsT) (*snapshotConn, map[string]string, error) {
+	db, ok := workArgs.DB.(*sql.DB)
+	if !ok {
+		return nil, nil, fmt.Errorf("snapshot already started")
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot := &snapshotConn{conn: conn}
+	workArgs.DB = snapshot
+
+	var position map[string]string
+	if workArgs.DbType == "postgres" {
+		if _, err = snapshot.Exec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"); err == nil {
+			position, err = captureSourcePosition(workArgs)
+		}
+	} else {
+		position, err = beginMysqlSnapshot(workArgs)
+	}
+	if err != nil {
+		_ = snapshot.Close()
+		return nil, nil, err
+	}
+
+	return snapshot, position, nil
+}
+
+// beginMysqlSnapshot 在 workArgs.DB 的专用连接上加全局读锁, 开启快照事务并读取 binlog 位置
+func beginMysqlSnapshot(workArgs workArgsT) (map[string]string, error) {
+	_, errLock := workArgs.DB.Exec("FLUSH TABLES WITH READ LOCK")
+	if errLock != nil {
+		log.Printf("[beginSnapshot] can not lock tables, the position may be earlier than the snapshot, err: %v", errLock)
+	}
+	if _, err := workArgs.DB.Exec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return nil, err
+	}
+	if _, err := workArgs.DB.Exec("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return nil, err
+	}
+	position, err := captureSourcePosition(workArgs)
+	if errLock == nil {
+		if _, errU := workArgs.DB.Exec("UNLOCK TABLES"); errU != nil && err == nil {
+			err = errU
+		}
+	}
+
+	return position, err
+}
+
+// captureSourcePosition 读取当前 binlog/GTID(mysql) 或 WAL(postgres) 位置
+func captureSourcePosition(workArgs workArgsT) (map[string]string, error) {
+	position := make(map[string]string)
+
+	if workArgs.DbType == "postgres" {
+		var lsn string
+		err := workArgs.DB.QueryRow("SELECT pg_current_wal_lsn()::text").Scan(&lsn)
+		if err != nil {
+			return nil, err
+		}
+		position["wal_lsn"] = lsn
+
+		return position, nil
+	}
+
+	// mysql 8.4 起 SHOW MASTER STATUS 改名为 SHOW BINARY LOG STATUS
+	rows, err := workArgs.DB.Query("SHOW MASTER STATUS")
+	if err != nil {
+		rows, err = workArgs.DB.Query("SHOW BINARY LOG STATUS")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	cols, _ := rows.Columns()
+	if !rows.Next() {
+		return nil, fmt.Errorf("binary log is not enabled")
+	}
+
+	refs := make([]interface{}, len(cols))
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+	if err = rows.Scan(refs...); err != nil {
+		return nil, err
+	}
+
+	for k, col := range cols {
+		val := reflect.Indirect(reflect.ValueOf(refs[k])).Interface()
+		position[col] = strings.Replace(rawValue(val), "\n", "", -1)
+	}
+
+	return position, nil
+}
+
+// sourcePositionComment 把位置信息格式化为导出文件头部的注释
+func sourcePositionComment(position map[string]string) string {
+	var keys []string
+	for k := range position {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var items []string
+	for _, k := range keys {
+		items = append(items, fmt.Sprintf("%s=%s", k, position[k]))
+	}
+
+	return fmt.Sprintf("/* source position: %s */\n\n", strings.Join(items, " "))
+}
+
+// writeSourcePosition 把位置信息以 json 写入旁路文件
+func writeSourcePosition(filename string, position map[string]string) error {
+	data, err := json.MarshalIndent(position, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// exportPresets 内置的参数组合, 命令行上显式设置的参数优先
+var exportPresets = map[string][]string{
+	// 与 mysqldump 默认输出接近: 表结构和数据, 关闭外键检查, 保留自增计数, 固定字符集和时区, 单条 INSERT 不超过 1MB
+	"mysqldump-compatible": {"model=all", "disable-checks=true", "keep-auto-increment=true", "session-charset=utf8mb4",
+		"session-time-zone=+00:00", "max-statement-bytes=1048576"},
+	// 开发环境的种子数据: 每张表抽样最多 1000 行, 导入时不检查外键, 常见的个人信息列脱敏, 可以交给开发人员使用
+	"dev-seed-masked": {"model=all", "sample=10%", "limit=1000", "disable-checks=true",
+		"mask=email=partial", "mask=phone=partial:3", "mask=mobile=partial:3", "mask=id_card=partial:4", "mask=password=fixed:"},
+}
+
+// presetNames 返回排序后的预设名
+func presetNames() []string {
+	var names []string
+	for name := range exportPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// applyPreset 在 flag.Parse 之后设置预设中的参数, 已在命令行上设置的参数不覆盖
+func applyPreset(name string) error {
+	values, ok := exportPresets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset: %s, support: %s", name, strings.Join(presetNames(), ","))
+	}
+
+	set := setFlags()
+
+	for _, value := range values {
+		kv := strings.SplitN(value, "=", 2)
+		// key=value 形式的参数按键合并, 命令行和 -mask-file 中同一列的规则优先
+		if f := flag.Lookup(kv[0]); f != nil {
+			if m, ok := f.Value.(kvFlag); ok {
+				if _, exists := m[strings.SplitN(kv[1], "=", 2)[0]]; !exists {
+					_ = m.Set(kv[1])
+				}
+				continue
+			}
+		}
+		if set[kv[0]] {
+			continue
+		}
+		if err := flag.Set(kv[0], kv[1]); err != nil {
+			return fmt.Errorf("preset %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// writePrimeScript 写出 -prime-script 预热脚本, 导入后执行可把导出的表和索引读入缓存:
+// mysql 按每个索引 FORCE INDEX 全扫描, postgres 使用 pg_prewarm 加载表和全部索引.
+func writePrimeScript(workArgs workArgsT, tables []string) {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("/* cache priming script by %s, run after the import */\n\n", programName))
+
+	if workArgs.DbType == "postgres" {
+		sb.WriteString("CREATE EXTENSION IF NOT EXISTS pg_prewarm;\n\n")
+		for _, tbl := range tables {
+			name := workArgs.EscapeFunc(quoteTable(workArgs, renameTable(workArgs, tbl)))
+			sb.WriteString(fmt.Sprintf("SELECT pg_prewarm('%s');\n", name))
+			sb.WriteString(fmt.Sprintf("SELECT pg_prewarm(indexrelid::regclass) FROM pg_index WHERE indrelid = '%s'::regclass;\n\n", name))
+		}
+	} else {
+		for _, tbl := range tables {
+			// 主键即聚簇索引, 扫描主键会加载整张表; 没有索引时全表扫描
+			indexes := tableIndexes(workArgs, tbl)
+			target := quoteTable(workArgs, renameTable(workArgs, tbl))
+			if len(indexes) == 0 {
+				sb.WriteString(fmt.Sprintf("SELECT COUNT(*) FROM %s;\n", target))
+			}
+			for _, index := range indexes {
+				sb.WriteString(fmt.Sprintf("SELECT COUNT(*) FROM %s FORCE INDEX (%s);\n", target, quoteIdent(workArgs, index)))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	if err := ioutil.WriteFile(workArgs.PrimeScript, []byte(sb.String()), 0644); err != nil {
+		log.Printf("[writePrimeScript] write file: %s, err: %v", workArgs.PrimeScript, err)
+		os.Exit(20)
+	}
+	log.Printf("[writePrimeScript] tables: %d, file: %s", len(tables), workArgs.PrimeScript)
+}
+
+// tableIndexes 返回 mysql 表的索引名, 主键在最前; 表在源库中不存在(如分表的逻辑表)时返回空
+func tableIndexes(workArgs workArgsT, table string) []string {
+	rows, err := workArgs.DB.Query(`SELECT DISTINCT INDEX_NAME FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY INDEX_NAME <> 'PRIMARY', INDEX_NAME`, table)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var indexes []string
+	for rows.Next() {
+		var index string
+		if errS := rows.Scan(&index); errS != nil {
+			log.Printf("[tableIndexes] rows.Scan err: %v", errS)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// mysql 未开启 parseTime 时时间列以字符串返回的格式
+const (
+	mysqlDateLayout     = "2006-01-02"
+	mysqlDatetimeLayout = "2006-01-02 15:04:05.999999"
+)
+
+// renderValue 把扫描得到的值转换为与系统 locale 无关的字符串: 数字使用 . 作为小数点, 时间按 -date-format/-timestamp-format 输出
+func renderValue(workArgs workArgsT, val interface{}, dbType string) string {
+	dbType = strings.ToUpper(dbType)
+
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return reformatTime(workArgs, string(v), dbType)
+	case string:
+		return reformatTime(workArgs, v, dbType)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		if v.IsZero() && workArgs.DbType == "mysql" {
+			// parseTime 把 0000-00-00 解析为零值, 还原为 mysql 的零日期
+			if dbType == "DATE" {
+				return "0000-00-00"
+			}
+			return "0000-00-00 00:00:00"
+		}
+		if dbType == "DATE" {
+			return v.Format(workArgs.DateFormat)
+		}
+		if dbType == "TIMESTAMPTZ" && workArgs.TimestampFormat == mysqlDatetimeLayout {
+			// 带时区的列保留偏移, 避免导入时按目标会话时区解释
+			return v.Format(mysqlDatetimeLayout + "Z07:00")
+		}
+		return v.Format(workArgs.TimestampFormat)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// reformatTime 字符串形式的时间列按 -date-format/-timestamp-format 重新格式化, 无法解析时原样返回
+func reformatTime(workArgs workArgsT, value string, dbType string) string {
+	switch dbType {
+	case "DATE":
+		if workArgs.DateFormat == mysqlDateLayout {
+			return value
+		}
+		if t, err := time.Parse(mysqlDateLayout, value); err == nil {
+			return t.Format(workArgs.DateFormat)
+		}
+	case "DATETIME", "TIMESTAMP":
+		if workArgs.TimestampFormat == mysqlDatetimeLayout {
+			return value
+		}
+		if t, err := time.Parse(mysqlDatetimeLayout, value); err == nil {
+			return t.Format(workArgs.TimestampFormat)
+		}
+	}
+
+	return value
+}
+
+// 不按文本校验编码的二进制列类型
+var binaryColumnTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true, "BLOB": true, "TINYBLOB": true, "MEDIUMBLOB": true,
+	"LONGBLOB": true, "BYTEA": true, "BIT": true, "GEOMETRY": true,
+}
+
+// validateUTF8 检查文本列的编码, 有非法字节序列时记录日志, 开启 -fix-utf8 时替换为 U+FFFD
+func validateUTF8(workArgs workArgsT, value string, column string, dbType string, record map[string]interface{}) string {
+	if binaryColumnTypes[strings.ToUpper(dbType)] || utf8.ValidString(value) {
+		return value
+	}
+
+	var pk []string
+	for _, col := range workArgs.PrimaryKey {
+		pk = append(pk, fmt.Sprintf("%s=%s", col, rawValue(record[col])))
+	}
+	workArgs.Logger.Printf("[validateUTF8] invalid utf8, table: %s, pk: %s, column: %s", workArgs.Table, strings.Join(pk, ","), column)
+	workArgs.Summary.Warn()
+
+	if workArgs.FixUTF8 {
+		return tools.ToValidUTF8(value, "\uFFFD")
+	}
+
+	return value
+}
+
+// numericColumnTypes 数值列, INSERT 中不加引号
+var numericColumnTypes = map[string]bool{
+	"TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "INT": true, "INTEGER": true, "BIGINT": true,
+	"DECIMAL": true, "NUMERIC": true, "FLOAT": true, "DOUBLE": true, "REAL": true, "YEAR": true,
+	"INT2": true, "INT4": true, "INT8": true, "FLOAT4": true, "FLOAT8": true, "OID": true,
+}
+
+// sqlLiteral 按列类型输出 SQL 字面量: 数值不加引号, 布尔为 TRUE/FALSE, 开启 -json-cast 时 JSON 列显式转换, 其他加引号并转义;
+// NaN, Infinity 等不是合法数字字面量的值仍加引号.
+func sqlLiteral(workArgs workArgsT, value string, dbType string) string {
+	dbType = strings.TrimPrefix(strings.ToUpper(dbType), "UNSIGNED ")
+
+	if numericColumnTypes[dbType] && isJSONNumber(value) {
+		return value
+	}
+	if dbType == "BOOL" || dbType == "BOOLEAN" {
+		if value == "1" || strings.EqualFold(value, "true") || value == "t" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	if workArgs.JSONCast && (dbType == "JSON" || dbType == "JSONB") {
+		if workArgs.DbType == "postgres" {
+			return fmt.Sprintf(`'%s'::%s`, workArgs.EscapeFunc(value), strings.ToLower(dbType))
+		}
+		return fmt.Sprintf(`CAST('%s' AS JSON)`, workArgs.EscapeFunc(value))
+	}
+
+	return fmt.Sprintf(`'%s'`, workArgs.EscapeFunc(value))
+}
+
+// mysqlGeometryLiteral 把 mysql 内部格式的空间数据(4 字节小端 SRID + WKB)转换为 ST_GeomFromWKB 表达式;
+// 非 0 SRID 显式指定经度在前的轴顺序, 与内部存储一致 (mysql 8).
+// postgis 的 geometry 以十六进制 EWKB 文本返回, 作为字符串字面量即可导入, 不需要转换.
+func mysqlGeometryLiteral(val []byte) (string, bool) {
+	if len(val) < 4 {
+		return "", false
+	}
+
+	srid := binary.LittleEndian.Uint32(val[:4])
+	wkb := strings.ToUpper(hex.EncodeToString(val[4:]))
+	if srid == 0 {
+		return fmt.Sprintf("ST_GeomFromWKB(X'%s')", wkb), true
+	}
+
+	return fmt.Sprintf("ST_GeomFromWKB(X'%s', %d, 'axis-order=long-lat')", wkb, srid), true
+}
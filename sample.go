@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// rowSampler 按 -limit 和 -sample 控制单张表导出的行, 并发导出时各 worker 共享, -shard 时同一逻辑表的各分表共享
+type rowSampler struct {
+	limit int64
+	every int64   // 每 every 行取一行
+	rate  float64 // 按比例均匀取行, 0 表示不按比例
+
+	sqlCond        string // 下推到 mysql 查询的抽样条件
+	sqlTableSample string // 下推到 postgres 查询的 TABLESAMPLE 子句
+
+	mu      sync.Mutex
+	scanned int64
+	kept    int64
+}
+
+// newRowSampler sample 支持 5% (按比例, 可下推到查询) 和 N (按读取顺序每 N 行取一行) 两种写法
+func newRowSampler(limit int64, sample string) (*rowSampler, error) {
+	s := &rowSampler{limit: limit, every: 1}
+	if len(sample) == 0 {
+		return s, nil
+	}
+
+	if strings.HasSuffix(sample, "%") {
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(sample, "%"), 64)
+		if err != nil || rate <= 0 || rate > 100 {
+			return nil, fmt.Errorf("invalid sample rate: %s", sample)
+		}
+		s.rate = rate / 100
+		return s, nil
+	}
+
+	every, err := strconv.ParseInt(sample, 10, 64)
+	if err != nil || every <= 0 {
+		return nil, fmt.Errorf("invalid sample: %s", sample)
+	}
+	s.every = every
+
+	return s, nil
+}
+
+// pushDown 把按比例的抽样下推到查询, 不再读取整表后逐行丢弃: postgres 用 TABLESAMPLE BERNOULLI ... REPEATABLE,
+// mysql 按主键的 CRC32 取模, 两者在各分块查询中抽中的行一致, 行数接近比例但不固定.
+// 每 N 行取一行需要按读取顺序计数, 不下推; 自定义查询, 系统表, 系统版本表和没有主键的 mysql 表也仍在读取时逐行抽样.
+func (s *rowSampler) pushDown(workArgs workArgsT) {
+	if s == nil {
+		return
+	}
+
+	// 分表共用同一个 rowSampler, 只在第一张分表下推一次
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rate == 0 {
+		return
+	}
+	if _, custom := workArgs.TableSQL[workArgs.Table]; custom || workArgs.History || (len(workArgs.AsOf) > 0 && len(workArgs.ValidityColumns) == 0) ||
+		isSystemObject(workArgs.Table) {
+		return
+	}
+
+	percent := s.rate * 100
+
+	if workArgs.DbType == "postgres" {
+		s.sqlTableSample = fmt.Sprintf(" TABLESAMPLE BERNOULLI (%g) REPEATABLE (0)", percent)
+	} else if len(workArgs.PrimaryKey) > 0 {
+		s.sqlCond = fmt.Sprintf("CRC32(CONCAT_WS(',', %s)) %% 1000000 < %d", quoteIdents(workArgs, workArgs.PrimaryKey), int64(percent*10000))
+	} else {
+		return
+	}
+	workArgs.Logger.Printf("[pushDown] sample %s in sql%s%s", workArgs.Sample, s.sqlTableSample, s.sqlCond)
+	s.rate = 0
+}
+
+// condition 返回下推到 WHERE 的抽样条件, 没有时返回空
+func (s *rowSampler) condition() string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sqlCond
+}
+
+// tableSample 返回下推到表名之后的 TABLESAMPLE 子句, 没有时返回空
+func (s *rowSampler) tableSample() string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sqlTableSample
+}
+
+// Keep 返回当前行是否导出, 每扫描一行调用一次
+func (s *rowSampler) Keep() bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limit > 0 && s.kept >= s.limit {
+		return false
+	}
+
+	n := s.scanned
+	s.scanned++
+
+	var keep bool
+	if s.rate > 0 {
+		// 第 n 行跨过新的整数倍时取出, 取出的行均匀分布
+		keep = int64(float64(n+1)*s.rate) > int64(float64(n)*s.rate)
+	} else {
+		keep = n%s.every == 0
+	}
+	if keep {
+		s.kept++
+	}
+
+	return keep
+}
+
+// Done 返回是否已经达到 -limit
+func (s *rowSampler) Done() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.limit > 0 && s.kept >= s.limit
+}
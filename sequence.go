@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tableSequence 属于某张表某一列的 postgres 序列
+type tableSequence struct {
+	Name     string
+	Schema   string // 序列所在的 schema, 与 -db-schema 中的表一致
+	Column   string
+	Identity bool // IDENTITY 列的序列随建表语句创建, 只需要重置取值
+}
+
+// fetchTableSequences 返回 postgres 中属于该表列的序列 (serial/OWNED BY/IDENTITY)
+func fetchTableSequences(workArgs workArgsT, table string) []tableSequence {
+	querySQL := `SELECT seq.relname, n.nspname, a.attname, d.deptype = 'i' FROM pg_class seq
+JOIN pg_namespace n ON n.oid = seq.relnamespace
+JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = seq.oid AND d.deptype IN ('a', 'i')
+JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+WHERE seq.relkind = 'S' AND d.refobjid = $1::regclass
+ORDER BY seq.relname`
+
+	rows, err := workArgs.DB.Query(querySQL, quoteTable(workArgs, table))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var sequences []tableSequence
+	for rows.Next() {
+		var seq tableSequence
+		if errS := rows.Scan(&seq.Name, &seq.Schema, &seq.Column, &seq.Identity); errS != nil {
+			workArgs.Logger.Printf("[fetchTableSequences] rows.Scan err: %v", errS)
+			continue
+		}
+		sequences = append(sequences, seq)
+	}
+
+	return sequences
+}
+
+// sequenceInfo pg_sequences 中序列的定义和当前值
+type sequenceInfo struct {
+	DataType                          string
+	Start, Min, Max, Increment, Cache int64
+	Cycle                             bool
+	LastValue                         sql.NullInt64
+}
+
+// readSequence 读取序列的定义和当前值
+func readSequence(workArgs workArgsT, seq tableSequence) (sequenceInfo, error) {
+	var info sequenceInfo
+	querySQL := `SELECT data_type, start_value, min_value, max_value, increment_by, cache_size, cycle, last_value
+FROM pg_sequences WHERE schemaname = $1 AND sequencename = $2`
+	err := workArgs.DB.QueryRow(querySQL, seq.Schema, seq.Name).Scan(&info.DataType, &info.Start, &info.Min, &info.Max, &info.Increment, &info.Cache, &info.Cycle, &info.LastValue)
+
+	return info, err
+}
+
+// sequenceName 返回输出语句中加引号的序列名; 表名带 schema 时 (-db-schema 指定了多个 schema) 序列名同样带 schema
+func sequenceName(workArgs workArgsT, table string, seq tableSequence) string {
+	if strings.Contains(table, ".") {
+		return quoteIdent(workArgs, seq.Schema) + "." + quoteIdent(workArgs, seq.Name)
+	}
+
+	return quoteIdent(workArgs, seq.Name)
+}
+
+// createSequenceSQL 返回非 IDENTITY 序列的 CREATE SEQUENCE IF NOT EXISTS 语句, 不含结尾分号; name 为 sequenceName 的结果
+func createSequenceSQL(name string, info sequenceInfo) string {
+	cycleOpt := "NO CYCLE"
+	if info.Cycle {
+		cycleOpt = "CYCLE"
+	}
+
+	return fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s AS %s INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d CACHE %d %s",
+		name, info.DataType, info.Increment, info.Min, info.Max, info.Start, info.Cache, cycleOpt)
+}
+
+// writeTableSequences 在表数据之后写出序列的 CREATE SEQUENCE 和 setval, 导入后自增从正确的值继续
+func writeTableSequences(workArgs workArgsT, output io.Writer) {
+	for _, seq := range fetchTableSequences(workArgs, workArgs.Table) {
+		info, err := readSequence(workArgs, seq)
+		if err != nil {
+			workArgs.Logger.Printf("[writeTableSequences] can not read sequence %s, err: %v", seq.Name, err)
+			continue
+		}
+
+		name := sequenceName(workArgs, workArgs.Table, seq)
+		var sb strings.Builder
+		if !seq.Identity {
+			sb.WriteString(createSequenceSQL(name, info) + ";\n")
+			sb.WriteString(fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s;\n", name, quoteTable(workArgs, insertTable(workArgs)), quoteIdent(workArgs, seq.Column)))
+		}
+
+		// 从未取过值时 last_value 为空, 重置到起始值且下一次取值返回起始值; setval 的参数按 regclass 解析, 使用加引号的名称
+		if info.LastValue.Valid {
+			sb.WriteString(fmt.Sprintf("SELECT setval('%s', %d, true);\n\n", workArgs.EscapeFunc(name), info.LastValue.Int64))
+		} else {
+			sb.WriteString(fmt.Sprintf("SELECT setval('%s', %d, false);\n\n", workArgs.EscapeFunc(name), info.Start))
+		}
+
+		_, _ = io.WriteString(output, sb.String())
+		workArgs.Logger.Printf("[writeTableSequences] sequence: %s, column: %s, last value: %v", seq.Name, seq.Column, info.LastValue)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// shardGroup 按 -shard 归并的一组分表, Logical 为空表示普通表
+type shardGroup struct {
+	Logical string
+	Tables  []string
+}
+
+// groupShards 把匹配 -shard 的分表归到对应的逻辑表下, 逻辑表出现在第一张分表的位置, 其余表保持原顺序
+func groupShards(workArgs workArgsT, tables []string) []shardGroup {
+	var logicals []string
+	for logical := range workArgs.Shards {
+		logicals = append(logicals, logical)
+	}
+	sort.Strings(logicals)
+
+	var groups []shardGroup
+	index := make(map[string]int)
+	for _, tbl := range tables {
+		var logical string
+		for _, name := range logicals {
+			if tools.MatchAny(tbl, []string{workArgs.Shards[name]}) {
+				logical = name
+				break
+			}
+		}
+
+		if len(logical) == 0 {
+			groups = append(groups, shardGroup{Tables: []string{tbl}})
+			continue
+		}
+		if k, ok := index[logical]; ok {
+			groups[k].Tables = append(groups[k].Tables, tbl)
+			continue
+		}
+		index[logical] = len(groups)
+		groups = append(groups, shardGroup{Logical: logical, Tables: []string{tbl}})
+	}
+
+	return groups
+}
+
+// doWorkExportDataShards 把一组分表作为同一张逻辑表导出, INSERT 目标统一为逻辑表名;
+// -parallel 大于 1 时各分表并发导出到临时文件, 最后按分表顺序拼接.
+func doWorkExportDataShards(workArgs workArgsT, output *os.File, group shardGroup) {
+	log.Printf("[doWorkExportDataShards] logical table: %s, shards: %d", group.Logical, len(group.Tables))
+
+	// 逻辑表只清空一次, 并发导出时写在所有分表之前
+	clearArgs := workArgs
+	clearArgs.TargetTable = renameTable(workArgs, group.Logical)
+	writeClearTable(clearArgs, output)
+	workArgs.SkipClear = true
+	// 同一逻辑表的各分表之间去重
+	workArgs.Dedupe = newTableDedupe(workArgs)
+	// -limit 和 -sample 作用于整张逻辑表, 而不是每张分表
+	if workArgs.Limit > 0 || len(workArgs.Sample) > 0 {
+		workArgs.Sampler, _ = newRowSampler(workArgs.Limit, workArgs.Sample)
+	}
+
+	if workArgs.Parallel <= 1 {
+		for _, tbl := range group.Tables {
+			taskArgs := workArgs
+			taskArgs.Table = tbl
+			taskArgs.TargetTable = renameTable(workArgs, group.Logical)
+			doWorkExportData(taskArgs, output)
+		}
+		return
+	}
+
+	files := make([]*os.File, len(group.Tables))
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				_ = f.Close()
+				_ = os.Remove(f.Name())
+			}
+		}
+	}()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workArgs.Parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for k := range jobs {
+				f, errT := ioutil.TempFile("", programName+"-shard-")
+				if errT != nil {
+					panic(errT)
+				}
+				files[k] = f
+
+				taskArgs := workArgs
+				taskArgs.Table = group.Tables[k]
+				taskArgs.TargetTable = renameTable(workArgs, group.Logical)
+				// 并发已经在分表之间, 单张分表内不再切分
+				taskArgs.Parallel = 1
+				doWorkExportData(taskArgs, f)
+			}
+		}()
+	}
+	for k := range group.Tables {
+		jobs <- k
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, f := range files {
+		if _, errS := f.Seek(0, io.SeekStart); errS != nil {
+			panic(errS)
+		}
+		if _, errC := io.Copy(output, f); errC != nil {
+			panic(errC)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// columnStats 单列的统计信息, 二进制列不统计最小最大值
+type columnStats struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	NullCount int64   `json:"null_count"`
+	Min       *string `json:"min"`
+	Max       *string `json:"max"`
+}
+
+// tableStats 导出过程中顺带统计的单表各列 min/max/null 数量, 作为装载包的 <table>.stats.json
+type tableStats struct {
+	Table   string         `json:"table"`
+	Rows    int64          `json:"rows"`
+	Columns []*columnStats `json:"columns"`
+
+	mu sync.Mutex
+}
+
+// Add 统计一行, columns 与 vals 一一对应
+func (s *tableStats) Add(workArgs workArgsT, columns []bundleColumn, vals []interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Columns == nil {
+		for _, col := range columns {
+			s.Columns = append(s.Columns, &columnStats{Name: col.Name, Type: col.DbType})
+		}
+	}
+
+	s.Rows++
+	for k, col := range s.Columns {
+		if vals[k] == nil {
+			col.NullCount++
+			continue
+		}
+		if binaryColumnTypes[col.Type] {
+			continue
+		}
+
+		value := renderValue(workArgs, vals[k], col.Type)
+		if col.Min == nil || compareValues(value, *col.Min) < 0 {
+			v := value
+			col.Min = &v
+		}
+		if col.Max == nil || compareValues(value, *col.Max) > 0 {
+			v := value
+			col.Max = &v
+		}
+	}
+}
+
+// JSON 返回缩进格式的统计结果
+func (s *tableStats) JSON() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, _ := json.MarshalIndent(s, "", "  ")
+	return append(data, '\n')
+}
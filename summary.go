@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dumpSummary 汇总一次导出的各表行数和告警数, 写在导出文件末尾
+type dumpSummary struct {
+	mu       sync.Mutex
+	start    time.Time
+	tables   []string
+	rows     map[string]int64
+	bytes    int64
+	warnings int64
+	exceeded bool
+}
+
+func newDumpSummary() *dumpSummary {
+	return &dumpSummary{
+		start: time.Now(),
+		rows:  make(map[string]int64),
+	}
+}
+
+// AddRows 累加表的导出行数, 按首次出现的顺序记录表
+func (s *dumpSummary) AddRows(table string, n int64) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rows[table]; !ok {
+		s.tables = append(s.tables, table)
+	}
+	s.rows[table] += n
+}
+
+// AddBytes 累加写出的数据字节数
+func (s *dumpSummary) AddBytes(n int64) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.bytes += n
+	s.mu.Unlock()
+}
+
+// CheckLimits 总行数或字节数超过 -max-total-rows/-max-total-bytes 时中止导出, 防止误导出了错误的库;
+// 设置 -force 时只告警一次.
+func (s *dumpSummary) CheckLimits(workArgs workArgsT) {
+	if s == nil || (workArgs.MaxTotalRows <= 0 && workArgs.MaxTotalBytes <= 0) {
+		return
+	}
+
+	s.mu.Lock()
+	var total int64
+	for _, n := range s.rows {
+		total += n
+	}
+	over := (workArgs.MaxTotalRows > 0 && total > workArgs.MaxTotalRows) || (workArgs.MaxTotalBytes > 0 && s.bytes > workArgs.MaxTotalBytes)
+	warned := s.exceeded
+	if over {
+		s.exceeded = true
+	}
+	bytes := s.bytes
+	s.mu.Unlock()
+
+	if !over || warned {
+		return
+	}
+
+	msg := fmt.Sprintf("export exceeds guardrail, rows: %d (max %d), bytes: %d (max %d)", total, workArgs.MaxTotalRows, bytes, workArgs.MaxTotalBytes)
+	if workArgs.Force {
+		log.Printf("[CheckLimits] %s, continue because of -force", msg)
+		s.Warn()
+		return
+	}
+	log.Printf("[CheckLimits] %s, abort; use -force to export anyway", msg)
+	os.Exit(22)
+}
+
+// Warn 记录一次告警
+func (s *dumpSummary) Warn() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.warnings++
+	s.mu.Unlock()
+}
+
+// Tables 返回按首次出现顺序记录的表
+func (s *dumpSummary) Tables() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.tables...)
+}
+
+// Footer 生成导出文件末尾的注释, 文件中没有该注释说明导出未完成
+func (s *dumpSummary) Footer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timeNow := time.Now()
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("/* export completed at: %d-%02d-%02d %02d:%02d:%02d, duration: %s, warnings: %d, options: %s\n",
+		timeNow.Year(), int(timeNow.Month()), timeNow.Day(),
+		timeNow.Hour(), timeNow.Minute(), timeNow.Second(),
+		timeNow.Sub(s.start).Round(time.Millisecond), s.warnings, optionHash()))
+	for _, table := range s.tables {
+		sb.WriteString(fmt.Sprintf(" * %s: %d rows\n", table, s.rows[table]))
+	}
+	sb.WriteString(" */\n")
+
+	return sb.String()
+}
+
+// secretFlags 计算选项哈希时不包含这些参数的值
+var secretFlags = []string{"db-password", "db-pwd", "dsn", "target-dsn", "source"}
+
+// optionHash 对命令行显式设置的参数取 sha256, 截取前 12 位, 用于区分同一份数据的不同导出方式
+func optionHash() string {
+	var options []string
+	flag.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		for _, name := range secretFlags {
+			if f.Name == name {
+				value = "*"
+			}
+		}
+		options = append(options, f.Name+"="+value)
+	})
+	sort.Strings(options)
+
+	sum := sha256.Sum256([]byte(strings.Join(options, "\n")))
+	return fmt.Sprintf("%x", sum)[:12]
+}
+
+// countingWriter 统计写出的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
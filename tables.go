@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// parseChangedSince 解析 -changed-since, 返回与 information_schema 一致的时间格式
+func parseChangedSince(value string) (string, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t.Format("2006-01-02 15:04:05"), nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid time: %s, use YYYY-MM-DD[ HH:MM:SS]", value)
+}
+
+// filterChangedSince 跳过最后修改时间早于 -changed-since 的表, 无法判断修改时间的表保留.
+// -changed-since 按 -session-time-zone 解析, 未设置时按本地时区解析.
+func filterChangedSince(workArgs workArgsT, tables []string) []string {
+	if len(workArgs.ChangedSince) == 0 {
+		return tables
+	}
+
+	loc := time.Local
+	if len(workArgs.SessionTimeZone) > 0 {
+		loc, _ = loadTimeZone(workArgs.SessionTimeZone)
+	}
+	since, err := time.ParseInLocation("2006-01-02 15:04:05", workArgs.ChangedSince, loc)
+	if err != nil {
+		errMsg(fmt.Sprintf("invalid changed-since: %s", workArgs.ChangedSince), 17)
+	}
+
+	var updated map[string]time.Time
+	if workArgs.DbType == "postgres" {
+		updated = postgresTableUpdateTimes(workArgs)
+	} else {
+		updated = mysqlTableUpdateTimes(workArgs, loc)
+	}
+
+	var changed []string
+	for _, tbl := range tables {
+		updateTime, ok := updated[tbl]
+		if ok && updateTime.Before(since) {
+			log.Printf("[filterChangedSince] skip table: %s, update time: %s", tbl, updateTime.In(loc).Format("2006-01-02 15:04:05"))
+			continue
+		}
+		changed = append(changed, tbl)
+	}
+
+	return changed
+}
+
+// mysqlTableUpdateTimes 返回 information_schema.TABLES.UPDATE_TIME, 为空的表不返回.
+// 设置 -session-time-zone 时连接开启了 parseTime, UPDATE_TIME 以 time.Time 返回, 否则为会话时区的字符串, 按 loc 解析.
+func mysqlTableUpdateTimes(workArgs workArgsT, loc *time.Location) map[string]time.Time {
+	querySQL := "SELECT TABLE_NAME, UPDATE_TIME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()"
+	log.Printf("[mysqlTableUpdateTimes] sql: %s", querySQL)
+
+	rows, err := workArgs.DB.Query(querySQL)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	updated := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var updateTime interface{}
+		if errS := rows.Scan(&name, &updateTime); errS != nil {
+			log.Printf("[mysqlTableUpdateTimes] rows.Scan err: %v", errS)
+			continue
+		}
+
+		switch v := updateTime.(type) {
+		case time.Time:
+			updated[name] = v
+		case []byte:
+			t, errP := time.ParseInLocation("2006-01-02 15:04:05", string(v), loc)
+			if errP != nil {
+				log.Printf("[mysqlTableUpdateTimes] table: %s, invalid update time: %s", name, v)
+				continue
+			}
+			updated[name] = t
+		}
+	}
+
+	return updated
+}
+
+// postgresTableUpdateTimes 由 pg_stat_user_tables 推断表的最后修改时间: 最近一次 analyze 之后没有修改 (n_mod_since_analyze 为 0) 的表,
+// 最后修改不晚于该次 analyze; 有修改或从未 analyze 的表无法判断, 不返回. 当前 schema 的表同时以不带 schema 的表名返回.
+func postgresTableUpdateTimes(workArgs workArgsT) map[string]time.Time {
+	querySQL := "SELECT s.schemaname, s.relname, s.schemaname = current_schema(), GREATEST(s.last_analyze, s.last_autoanalyze) " +
+		"FROM pg_stat_user_tables s JOIN pg_class c ON c.oid = s.relid " +
+		"WHERE s.n_mod_since_analyze = 0 AND c.relkind = 'r'"
+	log.Printf("[postgresTableUpdateTimes] sql: %s", querySQL)
+
+	rows, err := workArgs.DB.Query(querySQL)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	updated := make(map[string]time.Time)
+	for rows.Next() {
+		var schema, name string
+		var current bool
+		var analyzed interface{}
+		if errS := rows.Scan(&schema, &name, &current, &analyzed); errS != nil {
+			log.Printf("[postgresTableUpdateTimes] rows.Scan err: %v", errS)
+			continue
+		}
+
+		t, ok := analyzed.(time.Time)
+		if !ok {
+			continue
+		}
+		updated[schema+"."+name] = t
+		if current {
+			updated[name] = t
+		}
+	}
+
+	return updated
+}
+
+// systemSchemas 系统库, 其中的表和视图只读, 内容随时变化
+var systemSchemas = []string{"information_schema", "performance_schema", "mysql", "sys", "pg_catalog"}
+
+// isSystemObject 返回 -table 中的名称是否为系统库中的表或视图, 如 information_schema.processlist
+func isSystemObject(name string) bool {
+	kv := strings.SplitN(name, ".", 2)
+
+	return len(kv) == 2 && tools.InArray(strings.ToLower(kv[0]), systemSchemas)
+}
+
+// listAllTables 返回当前库中的全部表, 不受 -table 等选择参数影响
+func listAllTables(workArgs workArgsT) []string {
+	workArgs.Table, workArgs.TableRegexp, workArgs.ExcludeTable, workArgs.ChangedSince, workArgs.Priority = "all", nil, "", "", ""
+
+	return fetchTables(workArgs)
+}
+
+// checkTablesExist 在写出任何内容之前对照数据库检查 -table 中明确列出的表, 带 schema 的名称查询 information_schema;
+// 有不存在的表时一次列出全部, 并给出相近的表名, 然后退出.
+func checkTablesExist(workArgs workArgsT) {
+	if workArgs.Table == "all" {
+		return
+	}
+
+	var allTables []string
+	var unknown []string
+	for _, name := range strings.Split(workArgs.Table, ",") {
+		// 模式由展开时匹配
+		if strings.ContainsAny(name, "*?[") {
+			continue
+		}
+		if strings.Contains(name, ".") {
+			if !qualifiedTableExists(workArgs, name) {
+				unknown = append(unknown, name)
+			}
+			continue
+		}
+		if allTables == nil {
+			allTables = listAllTables(workArgs)
+		}
+		if tools.InArray(name, allTables) {
+			continue
+		}
+
+		msg := name
+		if similar := similarTables(name, allTables); len(similar) > 0 {
+			msg += fmt.Sprintf(" (did you mean: %s?)", strings.Join(similar, ", "))
+		}
+		unknown = append(unknown, msg)
+	}
+
+	if len(unknown) > 0 {
+		errMsg(fmt.Sprintf("unknown table: %s", strings.Join(unknown, ", ")), 18)
+	}
+}
+
+// qualifiedTableExists 返回 schema.table 形式的表或视图是否存在, 系统库中的表名大小写不固定, 不区分大小写比较
+func qualifiedTableExists(workArgs workArgsT, name string) bool {
+	kv := strings.SplitN(name, ".", 2)
+	querySQL := "SELECT COUNT(*) FROM information_schema.tables WHERE LOWER(table_schema) = LOWER(?) AND LOWER(table_name) = LOWER(?)"
+	if workArgs.DbType == "postgres" {
+		querySQL = "SELECT COUNT(*) FROM information_schema.tables WHERE LOWER(table_schema) = LOWER($1) AND LOWER(table_name) = LOWER($2)"
+	}
+
+	var count int
+	if err := workArgs.DB.QueryRow(querySQL, kv[0], kv[1]).Scan(&count); err != nil {
+		panic(err)
+	}
+
+	return count > 0
+}
+
+// similarTables 按编辑距离返回最多 3 个相近的表名
+func similarTables(name string, tables []string) []string {
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	distances := make(map[string]int)
+	var similar []string
+	for _, tbl := range tables {
+		d := tools.EditDistance(strings.ToLower(name), strings.ToLower(tbl))
+		if d <= maxDistance {
+			distances[tbl] = d
+			similar = append(similar, tbl)
+		}
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		return distances[similar[i]] < distances[similar[j]]
+	})
+	if len(similar) > 3 {
+		similar = similar[:3]
+	}
+
+	return similar
+}
+
+// hasTablePattern 返回 -table 是否需要对照数据库中的表名展开: all, glob 或设置了 -table-regex
+func hasTablePattern(workArgs workArgsT) bool {
+	return workArgs.Table == "all" || workArgs.TableRegexp != nil || strings.ContainsAny(workArgs.Table, "*?[")
+}
+
+// tableSelected 返回表是否被 -table, -table-regex 选中且没有被 -exclude-table 排除
+func tableSelected(workArgs workArgsT, tbl string) bool {
+	if workArgs.Table != "all" && !tools.MatchAny(tbl, strings.Split(workArgs.Table, ",")) {
+		return false
+	}
+	if workArgs.TableRegexp != nil && !workArgs.TableRegexp.MatchString(tbl) {
+		return false
+	}
+	if len(workArgs.ExcludeTable) > 0 && tools.MatchAny(tbl, strings.Split(workArgs.ExcludeTable, ",")) {
+		log.Printf("[tableSelected] skip excluded table: %s", tbl)
+		return false
+	}
+
+	return true
+}
+
+// sortByPriority 按 -priority 中模式的顺序把重要的表排在前面, 未匹配的表保持原顺序放在最后
+func sortByPriority(workArgs workArgsT, tables []string) []string {
+	if len(workArgs.Priority) == 0 {
+		return tables
+	}
+
+	patterns := strings.Split(workArgs.Priority, ",")
+	rank := func(tbl string) int {
+		for i, pattern := range patterns {
+			if tools.MatchAny(tbl, []string{pattern}) {
+				return i
+			}
+		}
+		return len(patterns)
+	}
+
+	sort.SliceStable(tables, func(i, j int) bool {
+		return rank(tables[i]) < rank(tables[j])
+	})
+	log.Printf("[sortByPriority] tables: %v", tables)
+
+	return tables
+}
+
+// fetchForeignKeys 返回当前库中每张表通过外键引用的表
+func fetchForeignKeys(workArgs workArgsT) map[string][]string {
+	querySQL := `SELECT TABLE_NAME, REFERENCED_TABLE_NAME FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY TABLE_NAME, CONSTRAINT_NAME`
+	if workArgs.DbType == "postgres" {
+		querySQL = `SELECT c.conrelid::regclass::text, c.confrelid::regclass::text FROM pg_constraint c
+WHERE c.contype = 'f' AND c.connamespace = current_schema()::regnamespace
+ORDER BY 1, c.conname`
+	}
+	log.Printf("[fetchForeignKeys] sql: %s", querySQL)
+
+	rows, err := workArgs.DB.Query(querySQL)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	deps := make(map[string][]string)
+	for rows.Next() {
+		var tbl, ref string
+		if errS := rows.Scan(&tbl, &ref); errS != nil {
+			log.Printf("[fetchForeignKeys] rows.Scan err: %v", errS)
+			continue
+		}
+		if !tools.InArray(ref, deps[tbl]) {
+			deps[tbl] = append(deps[tbl], ref)
+		}
+	}
+
+	return deps
+}
+
+// orderedTables 返回要导出的表, 被外键引用的表排在前面, 导入时不会违反外键约束
+func orderedTables(workArgs workArgsT) []string {
+	tables := fetchTables(workArgs)
+	if len(tables) < 2 {
+		return tables
+	}
+
+	return sortByDependency(tables, fetchForeignKeys(workArgs))
+}
+
+// sortByDependency 把被引用的表排在引用它的表前面, 其余保持原顺序; 循环引用无法排序, 记录日志后按原顺序输出
+func sortByDependency(tables []string, deps map[string][]string) []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+
+	selected := make(map[string]bool, len(tables))
+	for _, tbl := range tables {
+		selected[tbl] = true
+	}
+
+	state := make(map[string]int, len(tables))
+	sorted := make([]string, 0, len(tables))
+
+	var visit func(tbl string)
+	visit = func(tbl string) {
+		switch state[tbl] {
+		case done:
+			return
+		case visiting:
+			log.Printf("[sortByDependency] foreign key cycle at table: %s, import may need FOREIGN_KEY_CHECKS=0", tbl)
+			return
+		}
+
+		state[tbl] = visiting
+		for _, ref := range deps[tbl] {
+			if selected[ref] && ref != tbl {
+				visit(ref)
+			}
+		}
+		state[tbl] = done
+		sorted = append(sorted, tbl)
+	}
+
+	for _, tbl := range tables {
+		visit(tbl)
+	}
+
+	return sorted
+}
+
+// nullableColumns 返回 columns 中允许 NULL 的列
+func nullableColumns(workArgs workArgsT, table string, columns []string) []string {
+	querySQL := `SELECT COLUMN_NAME FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND IS_NULLABLE = 'YES'`
+	relation := table
+	if workArgs.DbType == "postgres" {
+		querySQL = `SELECT attname FROM pg_attribute
+WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND NOT attnotnull`
+		relation = quoteTable(workArgs, table)
+	}
+
+	var nullable []string
+	for _, col := range queryStrings(workArgs, querySQL, relation) {
+		if tools.InArray(col, columns) {
+			nullable = append(nullable, col)
+		}
+	}
+
+	return nullable
+}
+
+// detectPrimaryKey 返回表的主键列, 按主键中的顺序
+func detectPrimaryKey(workArgs workArgsT, table string) []string {
+	querySQL := `SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+ORDER BY ORDINAL_POSITION`
+	relation := table
+	if workArgs.DbType == "postgres" {
+		querySQL = `SELECT a.attname FROM pg_index i
+JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+WHERE i.indrelid = $1::regclass AND i.indisprimary
+ORDER BY array_position(i.indkey::int2[], a.attnum)`
+		// regclass 按 SQL 标识符解析, 大写或含特殊字符的表名需要加引号
+		relation = quoteTable(workArgs, table)
+	}
+
+	rows, err := workArgs.DB.Query(querySQL, relation)
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var pk []string
+	for rows.Next() {
+		var col string
+		if errS := rows.Scan(&col); errS != nil {
+			workArgs.Logger.Printf("[detectPrimaryKey] rows.Scan err: %v", errS)
+			continue
+		}
+		pk = append(pk, col)
+	}
+
+	return pk
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶, 容量为一秒的配额
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve 取出 n 个令牌, 返回需要等待的时间; 令牌不足时记为欠账, 后来的调用方排在后面等待
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+	}
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimiter -max-rows-per-second/-max-bytes-per-second 的限速, 所有 worker 和表共用, 总速率不超过设置值
+type rateLimiter struct {
+	mu    sync.Mutex
+	rows  *tokenBucket
+	bytes *tokenBucket
+}
+
+func newRateLimiter(rowsPerSecond int64, bytesPerSecond int64) *rateLimiter {
+	if rowsPerSecond <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+
+	l := &rateLimiter{}
+	if rowsPerSecond > 0 {
+		l.rows = &tokenBucket{rate: float64(rowsPerSecond), tokens: float64(rowsPerSecond)}
+	}
+	if bytesPerSecond > 0 {
+		l.bytes = &tokenBucket{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond)}
+	}
+
+	return l
+}
+
+// Wait 读取一行后调用, 超过速率时阻塞
+func (l *rateLimiter) Wait(rows int, bytes int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	wait := l.rows.reserve(float64(rows), now)
+	if d := l.bytes.reserve(float64(bytes), now); d > wait {
+		wait = d
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// rowSize 估算一行从源库读取的字节数
+func rowSize(vals []interface{}) int {
+	var size int
+	for _, val := range vals {
+		switch v := val.(type) {
+		case []byte:
+			size += len(v)
+		case string:
+			size += len(v)
+		case nil:
+		default:
+			size += 8
+		}
+	}
+
+	return size
+}
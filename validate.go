@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// doWorkValidate 导出前对照数据库检查参数, 错误信息指出具体的参数和位置, 而不是在导出中途报 SQL 错误
+func doWorkValidate(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkValidate] start work")
+
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// 逐个检查 -table 中的表名和模式
+	if workArgs.Table != "all" {
+		allTables := listAllTables(workArgs)
+
+		for k, name := range strings.Split(workArgs.Table, ",") {
+			if strings.ContainsAny(name, "*?[") {
+				var matched bool
+				for _, tbl := range allTables {
+					matched = matched || tools.MatchAny(tbl, []string{name})
+				}
+				if !matched {
+					addProblem("table[%d]: pattern '%s' matches no table", k, name)
+				}
+			} else if !tools.InArray(name, allTables) {
+				if similar := similarTables(name, allTables); len(similar) > 0 {
+					addProblem("table[%d]: unknown table '%s', did you mean: %s?", k, name, strings.Join(similar, ", "))
+				} else {
+					addProblem("table[%d]: unknown table '%s'", k, name)
+				}
+			}
+		}
+	}
+
+	tables := fetchTables(workArgs)
+	if len(tables) == 0 {
+		addProblem("table: no table selected")
+	}
+
+	columns := make(map[string][]string)
+	for _, tbl := range tables {
+		taskArgs := workArgs
+		taskArgs.Table = tbl
+		querySQL := fmt.Sprintf("SELECT * FROM %s%s LIMIT 0", selectFrom(taskArgs), dataWhere(workArgs))
+		rows, err := workArgs.DB.Query(querySQL)
+		if err != nil {
+			if len(workArgs.Where) > 0 || len(workArgs.Since) > 0 {
+				addProblem("table '%s': where/since condition fails: %v", tbl, err)
+			} else {
+				addProblem("table '%s': %v", tbl, err)
+			}
+			continue
+		}
+		columns[tbl], _ = rows.Columns()
+		_ = rows.Close()
+	}
+
+	checkColumns := func(flagName string, value string) {
+		if len(value) == 0 {
+			return
+		}
+		for k, col := range strings.Split(value, ",") {
+			for _, tbl := range tables {
+				if cols, ok := columns[tbl]; ok && !tools.InArray(col, cols) {
+					addProblem("%s[%d]: unknown column '%s' in table '%s'", flagName, k, col, tbl)
+				}
+			}
+		}
+	}
+	checkColumns("only-field", workArgs.OnlyField)
+	checkColumns("dedupe-on", workArgs.DedupeOn)
+	checkColumns("incremental-column", workArgs.IncrementalColumn)
+
+	var orderTables []string
+	for tbl := range workArgs.OrderBy {
+		orderTables = append(orderTables, tbl)
+	}
+	sort.Strings(orderTables)
+	for _, tbl := range orderTables {
+		cols, ok := columns[tbl]
+		if !ok {
+			addProblem("order-by '%s': table is not exported", tbl)
+			continue
+		}
+		for k, col := range workArgs.OrderBy[tbl] {
+			if !tools.InArray(col, cols) {
+				addProblem("order-by '%s'[%d]: unknown column '%s'", tbl, k, col)
+			}
+		}
+	}
+
+	for _, problem := range problems {
+		_, _ = output.WriteString("[error] " + problem + "\n")
+	}
+	_, _ = output.WriteString(fmt.Sprintf("\n/* validate: %d tables, %d errors */\n", len(tables), len(problems)))
+
+	log.Printf("[doWorkValidate] jobs have done.")
+
+	if len(problems) > 0 {
+		_ = output.Close()
+		os.Exit(41)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/internet-dev/db-export-tool/pkg/tools"
+)
+
+// exportColumns 返回表中按 -skip-field/-only-field 过滤后要导出的列
+func exportColumns(workArgs workArgsT) []string {
+	rows, err := workArgs.DB.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", selectFrom(workArgs)))
+	if err != nil {
+		panic(err)
+	}
+	columns, _ := rows.Columns()
+	_ = rows.Close()
+
+	skipFields := strings.Split(workArgs.SkipField, ",")
+	var onlyFields []string
+	if len(workArgs.OnlyField) > 0 {
+		onlyFields = strings.Split(workArgs.OnlyField, ",")
+	}
+
+	var fields []string
+	for _, col := range columns {
+		if tools.InArray(col, skipFields) || (onlyFields != nil && !tools.InArray(col, onlyFields)) {
+			continue
+		}
+		fields = append(fields, col)
+	}
+
+	return fields
+}
+
+// columnGroups 把主键以外的列按 size 分组, 每组都以主键开头
+func columnGroups(columns []string, pk []string, size int) [][]string {
+	var groups [][]string
+	var group []string
+	for _, col := range columns {
+		if tools.InArray(col, pk) {
+			continue
+		}
+		group = append(group, col)
+		if len(group) == size {
+			groups = append(groups, append(append([]string{}, pk...), group...))
+			group = nil
+		}
+	}
+	if len(group) > 0 {
+		groups = append(groups, append(append([]string{}, pk...), group...))
+	}
+
+	return groups
+}
+
+// doWorkExportDataColumnGroups 把宽表按列切片导出, 每片为主键加一组列, 写到 <output>.<table>.partN.sql 并导入临时表 <table>__partN;
+// 另写出 <output>.<table>.recombine.sql, 按主键 JOIN 各临时表后插入原表并删除临时表.
+func doWorkExportDataColumnGroups(workArgs workArgsT, output io.Writer, columns []string) {
+	workArgs = withTaskLogger(workArgs, workArgs.Table, 0)
+	pk := detectPrimaryKey(workArgs, workArgs.Table)
+	groups := columnGroups(columns, pk, workArgs.ColumnGroupSize)
+	workArgs.Logger.Printf("[doWorkExportDataColumnGroups] columns: %d, groups: %d, pk: %v", len(columns), len(groups), pk)
+	if len(pk) == 0 || len(groups) <= 1 {
+		// 没有主键时无法按行合并各分片, 按整表导出
+		if len(pk) == 0 {
+			workArgs.Logger.Printf("[doWorkExportDataColumnGroups] no primary key, export whole rows")
+			workArgs.Summary.Warn()
+		}
+		doWorkExportData(workArgs, output)
+		return
+	}
+
+	ident := func(name string) string {
+		return quoteIdent(workArgs, name)
+	}
+	identList := func(alias string, names []string) string {
+		var items []string
+		for _, name := range names {
+			items = append(items, alias+ident(name))
+		}
+		return strings.Join(items, ", ")
+	}
+
+	// 分片临时表和合并语句都在目标库中执行, 使用改名后的表名
+	target := renameTable(workArgs, workArgs.Table)
+
+	var files []string
+	var selects []string
+	var joins []string
+	var drops []string
+	for k, group := range groups {
+		part := fmt.Sprintf("%s__part%d", target, k+1)
+		alias := fmt.Sprintf("p%d", k+1)
+		name := fmt.Sprintf("%s.%s.part%d.sql", workArgs.Output, workArgs.Table, k+1)
+		files = append(files, name)
+
+		f, err := os.Create(name)
+		if err != nil {
+			workArgs.Logger.Printf("[doWorkExportDataColumnGroups] can not create file: %s, err: %v", name, err)
+			os.Exit(20)
+		}
+		_, _ = io.WriteString(f, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS SELECT %s FROM %s WHERE 1 = 0;\n\n",
+			quoteTable(workArgs, part), identList("", group), quoteTable(workArgs, target)))
+
+		partArgs := workArgs
+		partArgs.OnlyField = strings.Join(group, ",")
+		partArgs.TargetTable = part
+		doWorkExportData(partArgs, f)
+		if err = f.Close(); err != nil {
+			workArgs.Logger.Printf("[doWorkExportDataColumnGroups] close file: %s, err: %v", name, err)
+			os.Exit(20)
+		}
+
+		if k == 0 {
+			selects = append(selects, identList(alias+".", pk))
+			joins = append(joins, fmt.Sprintf("%s %s", quoteTable(workArgs, part), alias))
+		} else {
+			joins = append(joins, fmt.Sprintf("JOIN %s %s USING (%s)", quoteTable(workArgs, part), alias, identList("", pk)))
+		}
+		selects = append(selects, identList(alias+".", group[len(pk):]))
+		drops = append(drops, fmt.Sprintf("DROP TABLE %s;\n", quoteTable(workArgs, part)))
+	}
+
+	var recombined []string
+	for _, group := range groups {
+		if len(recombined) == 0 {
+			recombined = append(recombined, pk...)
+		}
+		recombined = append(recombined, group[len(pk):]...)
+	}
+
+	// 各分片不是同一快照, 只合并所有分片中都存在的行
+	script := fmt.Sprintf("INSERT INTO %s (%s)\nSELECT %s\nFROM %s;\n\n%s", quoteTable(workArgs, target), identList("", recombined),
+		strings.Join(selects, ", "), strings.Join(joins, "\n"), strings.Join(drops, ""))
+	recombine := fmt.Sprintf("%s.%s.recombine.sql", workArgs.Output, workArgs.Table)
+	if err := ioutil.WriteFile(recombine, []byte(script), 0644); err != nil {
+		workArgs.Logger.Printf("[doWorkExportDataColumnGroups] write file: %s, err: %v", recombine, err)
+		os.Exit(20)
+	}
+
+	_, _ = io.WriteString(output, fmt.Sprintf("/* table %s is exported in %d column groups: %s; load them, then run %s */\n\n",
+		workArgs.Table, len(groups), strings.Join(files, ", "), recombine))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// yamlPlainKeyRe 不需要加引号的键
+var yamlPlainKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// doWorkExportYAML -format=yaml: 每张表一个键, 值为按行排列的映射列表, 列按表中的顺序输出;
+// 标量沿用 JSON 的写法 (JSON 标量也是合法的 YAML), JSON 列输出为嵌套的流式映射.
+func doWorkExportYAML(workArgs workArgsT, output *os.File) {
+	log.Printf("[doWorkExportYAML] start work")
+
+	w := bufio.NewWriter(output)
+	for _, tbl := range fetchTables(workArgs) {
+		taskArgs := withTaskLogger(workArgs, tbl, 0)
+		taskArgs.Table = tbl
+		if taskArgs.Limit > 0 || len(taskArgs.Sample) > 0 {
+			taskArgs.Sampler, _ = newRowSampler(taskArgs.Limit, taskArgs.Sample)
+		}
+
+		_, _ = w.WriteString(yamlKey(tbl) + ":")
+		var count int64
+		forEachDataRow(taskArgs, func(cols []bundleColumn, vals []interface{}) {
+			for k, col := range cols {
+				prefix := "\n    "
+				if k == 0 {
+					prefix = "\n  - "
+				}
+				_, _ = w.WriteString(prefix + yamlKey(col.Name) + ": " + yamlValue(taskArgs, vals[k], col.DbType))
+			}
+			count++
+		})
+		if count == 0 {
+			_, _ = w.WriteString(" []")
+		}
+		_, _ = w.WriteString("\n")
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Printf("[doWorkExportYAML] write err: %v", err)
+		os.Exit(20)
+	}
+
+	log.Printf("[doWorkExportYAML] jobs have done.")
+}
+
+// yamlKey 只包含字母数字下划线且不是 YAML 关键字的键原样输出, 其他加引号
+func yamlKey(name string) string {
+	switch strings.ToLower(name) {
+	case "true", "false", "null", "yes", "no", "on", "off", "y", "n":
+	default:
+		if yamlPlainKeyRe.MatchString(name) {
+			return name
+		}
+	}
+
+	key, _ := json.Marshal(name)
+	return string(key)
+}
+
+func yamlValue(workArgs workArgsT, val interface{}, dbType string) string {
+	text := bigqueryValue(workArgs, val, dbType)
+	if !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "[") {
+		return text
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		value, _ := json.Marshal(text)
+		return string(value)
+	}
+
+	var buf bytes.Buffer
+	writeYAMLFlow(&buf, v)
+	return buf.String()
+}
+
+// writeYAMLFlow 把 JSON 值写成流式 YAML, 冒号和逗号后加空格以兼容 YAML 1.1 的解析器; 对象的键按字典序输出
+func writeYAMLFlow(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for k, key := range keys {
+			if k > 0 {
+				buf.WriteString(", ")
+			}
+			name, _ := json.Marshal(key)
+			buf.Write(name)
+			buf.WriteString(": ")
+			writeYAMLFlow(buf, v[key])
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for k, item := range v {
+			if k > 0 {
+				buf.WriteString(", ")
+			}
+			writeYAMLFlow(buf, item)
+		}
+		buf.WriteByte(']')
+	default:
+		text, _ := json.Marshal(v)
+		buf.Write(text)
+	}
+}